@@ -5,11 +5,14 @@ go 1.23.0
 toolchain go1.24.4
 
 require (
+	github.com/lib/pq v1.12.3
 	github.com/mattn/go-sqlite3 v1.14.28
 	github.com/mdp/qrterminal v1.0.1
 	github.com/subosito/gotenv v1.6.0
 	go.mau.fi/whatsmeow v0.0.0-20250617170509-947866bb9f75
+	golang.org/x/image v0.28.0
 	google.golang.org/protobuf v1.36.6
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -1,13 +1,71 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	conn "hisoka/src"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
+	"hisoka/src/simulator"
 
 	"github.com/subosito/gotenv"
 )
 
 func main() {
+	command, args := "run", []string{}
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+	switch command {
+	case "help", "-h", "-help", "--help":
+		conn.Usage(os.Stdout)
+		return
+	}
+
 	gotenv.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ [CONFIG] Configuração inválida:\n%s\n", err.Error())
+		os.Exit(2)
+	}
+	if err := helpers.SetupLogger(cfg.Log); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ [LOG] %s\n", err.Error())
+		os.Exit(2)
+	}
 
-	conn.StartClient()
+	switch command {
+	case "run":
+		conn.StartClient(cfg)
+	case "pair":
+		os.Exit(conn.PairMain(cfg, args))
+	case "logout":
+		os.Exit(conn.LogoutMain(cfg, args))
+	case "status":
+		os.Exit(conn.StatusMain(cfg, args))
+	case "users":
+		os.Exit(conn.UsersMain(cfg, args))
+	case "stages":
+		os.Exit(conn.StagesMain(cfg, args))
+	case "tickets":
+		os.Exit(conn.TicketsMain(cfg, args))
+	case "db":
+		os.Exit(conn.DBMain(cfg, args))
+	case "simulate":
+		os.Exit(simulator.Main(args))
+	case "scenarios":
+		os.Exit(simulator.ScenariosMain(args))
+	case "graph":
+		os.Exit(conn.GraphMain(cfg, args))
+	case "lint":
+		os.Exit(conn.LintMain(cfg, args))
+	case "migrate":
+		os.Exit(conn.MigrateMain(cfg, args))
+	case "config":
+		os.Exit(conn.ConfigMain(cfg, args))
+	default:
+		fmt.Fprintf(os.Stderr, "❌ Comando desconhecido: %s\n\n", command)
+		conn.Usage(os.Stderr)
+		os.Exit(2)
+	}
 }
@@ -0,0 +1,559 @@
+package conn
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/handlers"
+	"hisoka/src/helpers"
+	"hisoka/src/libs"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+const usage = `Uso: bot [comando] [opções]
+
+Comandos:
+  run                                  Inicia o bot (padrão, sem comando)
+  pair [-session id] [-phone número]   Pareia a sessão por QR code ou código de pareamento
+  logout [-session id]                 Desconecta o número e remove o pareamento
+  status                               Mostra pareamento, conexão e fila de cada sessão
+  users list [-session id] [-stage id] Lista os usuários e o stage atual
+  users show [-session id] <número>    Mostra o estado e os chamados de um usuário
+  users reset [-session id] <número>   Apaga o estado: a próxima mensagem começa no stage raiz
+  stages list                          Lista os stages registrados
+  tickets list [-status open|closed|all] [-session id] [-user número]
+                                       Lista os chamados abertos pelo atendimento
+  db backup [-o diretório]             Copia stages.db e session.db
+  config                               Mostra a configuração efetiva
+  migrate [status|up]                  Mostra ou aplica as migrações do stages.db
+  simulate, scenarios, graph, lint     Ferramentas de desenvolvimento do fluxo
+
+pair e logout conectam ao WhatsApp: pare o bot antes de usá-los.
+`
+
+// Usage escreve a ajuda da linha de comando
+func Usage(w io.Writer) {
+	fmt.Fprint(w, usage)
+}
+
+// Abre o stages.db de DATA_DIR (aplicando as migrações) e carrega as
+// sessões, sem conectar ao WhatsApp. Os logs da inicialização são descartados.
+func openStages(cfg *config.Config) (func(), error) {
+	err := helpers.WithoutLogs(func() error {
+		if _, err := libs.LoadSessions(cfg); err != nil {
+			return err
+		}
+		return libs.InitStages(cfg)
+	})
+	if err != nil {
+		libs.CloseStagesDB()
+		return nil, err
+	}
+	return func() { libs.CloseStagesDB() }, nil
+}
+
+// Sessão escolhida com -session; sem a opção, a única sessão configurada
+func selectSession(id string) (*libs.Session, error) {
+	if id != "" {
+		session := libs.GetSession(id)
+		if session == nil {
+			return nil, fmt.Errorf("sessão '%s' não configurada", id)
+		}
+		return session, nil
+	}
+	if sessions := libs.GetSessions(); len(sessions) > 1 {
+		ids := make([]string, len(sessions))
+		for i, session := range sessions {
+			ids[i] = session.ID
+		}
+		return nil, fmt.Errorf("várias sessões configuradas, escolha uma com -session (%s)", strings.Join(ids, ", "))
+	}
+	return libs.DefaultSession(), nil
+}
+
+// Número informado pelo operador, apenas com os dígitos
+func phoneArg(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+}
+
+func formatTime(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+	return time.Unix(unix, 0).Format("2006-01-02 15:04")
+}
+
+func cliError(tag string, err error) int {
+	fmt.Fprintf(os.Stderr, "❌ [%s] %s\n", tag, err.Error())
+	return 1
+}
+
+// PairMain executa o subcomando "pair": pareia a sessão por código (com
+// -phone ou PAIRING_NUMBER) ou por QR code e sai quando a conexão é aceita
+func PairMain(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("pair", flag.ContinueOnError)
+	sessionID := flags.String("session", "", "sessão a parear (padrão: a única configurada)")
+	phone := flags.String("phone", "", "número para o código de pareamento (padrão: PAIRING_NUMBER; vazio = QR code)")
+	timeout := flags.Duration("timeout", 5*time.Minute, "tempo máximo para concluir o pareamento")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cleanup, err := openStages(cfg)
+	if err != nil {
+		return cliError("PAIR", err)
+	}
+	defer cleanup()
+	session, err := selectSession(*sessionID)
+	if err != nil {
+		return cliError("PAIR", err)
+	}
+	container, err := openSessionStore(cfg)
+	if err != nil {
+		return cliError("PAIR", err)
+	}
+	defer container.Close()
+
+	device, err := handlers.SessionDevice(context.Background(), container, session)
+	if err != nil {
+		return cliError("PAIR", err)
+	}
+	if device.ID != nil {
+		fmt.Printf("Sessão '%s' já pareada com %s (use logout para trocar o número)\n", session.ID, device.ID.User)
+		return 0
+	}
+
+	number := phoneArg(*phone)
+	if number == "" {
+		number = session.PairingNumber
+	}
+	client := whatsmeow.NewClient(device, helpers.WALogger("Client/"+session.ID))
+	failed := make(chan error, 1)
+	go func() {
+		if err := pairDevice(client, session.ID, number); err != nil {
+			failed <- err
+		}
+	}()
+
+	// WaitForConnection só retorna true depois do login com o novo dispositivo
+	paired := make(chan bool, 1)
+	go func() { paired <- client.WaitForConnection(*timeout) }()
+	select {
+	case err := <-failed:
+		client.Disconnect()
+		return cliError("PAIR", err)
+	case ok := <-paired:
+		if !ok {
+			client.Disconnect()
+			return cliError("PAIR", fmt.Errorf("pareamento não concluído em %s", *timeout))
+		}
+	}
+	defer client.Disconnect()
+
+	if err := libs.SaveSessionDevice(session.ID, client.Store.ID.String()); err != nil {
+		return cliError("PAIR", err)
+	}
+	libs.RecordConnectionEvent(session.ID, libs.ConnEventConnected, "pareado pela linha de comando")
+	fmt.Printf("✅ Sessão '%s' pareada com %s\n", session.ID, client.Store.ID.User)
+	return 0
+}
+
+// LogoutMain executa o subcomando "logout": desconecta o número no WhatsApp
+// e remove o dispositivo, que precisará ser pareado novamente
+func LogoutMain(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("logout", flag.ContinueOnError)
+	sessionID := flags.String("session", "", "sessão a desconectar (padrão: a única configurada)")
+	timeout := flags.Duration("timeout", 30*time.Second, "tempo máximo para conectar antes do logout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cleanup, err := openStages(cfg)
+	if err != nil {
+		return cliError("LOGOUT", err)
+	}
+	defer cleanup()
+	session, err := selectSession(*sessionID)
+	if err != nil {
+		return cliError("LOGOUT", err)
+	}
+	container, err := openSessionStore(cfg)
+	if err != nil {
+		return cliError("LOGOUT", err)
+	}
+	defer container.Close()
+
+	jid, err := libs.GetSessionDevice(session.ID)
+	if err != nil {
+		return cliError("LOGOUT", err)
+	}
+	if jid == "" {
+		fmt.Printf("Sessão '%s' não está pareada\n", session.ID)
+		return 0
+	}
+	parsed, err := types.ParseJID(jid)
+	if err != nil {
+		return cliError("LOGOUT", err)
+	}
+	device, err := container.GetDevice(context.Background(), parsed)
+	if err != nil {
+		return cliError("LOGOUT", err)
+	}
+
+	if device != nil {
+		client := whatsmeow.NewClient(device, helpers.WALogger("Client/"+session.ID))
+		if err := client.Connect(); err != nil {
+			return cliError("LOGOUT", err)
+		}
+		if !client.WaitForConnection(*timeout) {
+			// O número já pode ter sido desconectado pelo celular: remove apenas
+			// o dispositivo local
+			client.Disconnect()
+			fmt.Fprintf(os.Stderr, "⚠️ [LOGOUT] Não foi possível conectar, removendo apenas o pareamento local\n")
+			if err := device.Delete(context.Background()); err != nil {
+				return cliError("LOGOUT", err)
+			}
+		} else if err := client.Logout(context.Background()); err != nil {
+			client.Disconnect()
+			return cliError("LOGOUT", err)
+		}
+	}
+
+	if err := libs.DeleteSessionDevice(session.ID); err != nil {
+		return cliError("LOGOUT", err)
+	}
+	libs.RecordConnectionEvent(session.ID, libs.ConnEventLoggedOut, "logout pela linha de comando")
+	fmt.Printf("✅ Sessão '%s' desconectada; use pair para parear novamente\n", session.ID)
+	return 0
+}
+
+// StatusMain executa o subcomando "status": esquema do banco e, por sessão,
+// pareamento, último evento de conexão e fila de envio
+func StatusMain(cfg *config.Config, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "❌ [STATUS] Argumento desconhecido: %s\n", args[0])
+		return 2
+	}
+
+	cleanup, err := openStages(cfg)
+	if err != nil {
+		return cliError("STATUS", err)
+	}
+	defer cleanup()
+
+	version, err := libs.SchemaVersion()
+	if err != nil {
+		return cliError("STATUS", err)
+	}
+	fmt.Printf("stages.db:  %s (esquema %d, binário %d)\n", filepath.Join(cfg.DataDir, "stages.db"), version, libs.LatestSchemaVersion())
+	fmt.Printf("session.db: %s\n", filepath.Join(cfg.SessionDir, "session.db"))
+	fmt.Printf("estado:     %s\n\n", cfg.StateStore)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSÃO\tSTAGE RAIZ\tNÚMERO\tÚLTIMA CONEXÃO\tPENDENTES\tFALHAS")
+	for _, session := range libs.GetSessions() {
+		number := "não pareada"
+		jid, err := libs.GetSessionDevice(session.ID)
+		if err != nil {
+			return cliError("STATUS", err)
+		}
+		if parsed, err := types.ParseJID(jid); jid != "" && err == nil {
+			number = parsed.User
+		}
+
+		connection := "-"
+		evt, err := libs.LastConnectionEvent(session.ID)
+		if err != nil {
+			return cliError("STATUS", err)
+		}
+		if evt != nil {
+			connection = evt.Event + " em " + formatTime(evt.CreatedAt)
+		}
+
+		pending, err := libs.CountOutbound(session.ID, libs.OutboundPending)
+		if err != nil {
+			return cliError("STATUS", err)
+		}
+		failed, err := libs.CountOutbound(session.ID, libs.OutboundFailed)
+		if err != nil {
+			return cliError("STATUS", err)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\n", session.ID, session.RootStage, number, connection, pending, failed)
+	}
+	w.Flush()
+	return 0
+}
+
+// UsersMain executa o subcomando "users" (list, show e reset)
+func UsersMain(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ [USERS] Use: users list|show|reset")
+		return 2
+	}
+	action := args[0]
+	flags := flag.NewFlagSet("users "+action, flag.ContinueOnError)
+	sessionID := flags.String("session", "", "sessão (padrão: todas em list, a única configurada em show e reset)")
+	stageID := flags.String("stage", "", "apenas usuários neste stage (list)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cleanup, err := openStages(cfg)
+	if err != nil {
+		return cliError("USERS", err)
+	}
+	defer cleanup()
+
+	switch action {
+	case "list":
+		sessions := libs.GetSessions()
+		if *sessionID != "" {
+			session, err := selectSession(*sessionID)
+			if err != nil {
+				return cliError("USERS", err)
+			}
+			sessions = []*libs.Session{session}
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SESSÃO\tUSUÁRIO\tSTAGE\tATUALIZADO")
+		total := 0
+		for _, session := range sessions {
+			users, err := libs.ListUserStages(session.ID, *stageID)
+			if err != nil {
+				return cliError("USERS", err)
+			}
+			for _, user := range users {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", user.SessionID, user.UserID, user.CurrentStage, formatTime(user.UpdatedAt))
+			}
+			total += len(users)
+		}
+		w.Flush()
+		fmt.Printf("%d usuário(s)\n", total)
+		return 0
+
+	case "show", "reset":
+		if flags.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "❌ [USERS] Use: users %s [-session id] <número>\n", action)
+			return 2
+		}
+		session, err := selectSession(*sessionID)
+		if err != nil {
+			return cliError("USERS", err)
+		}
+		userID := phoneArg(flags.Arg(0))
+		userStage, err := libs.GetStateStore().Get(session.ID, userID)
+		if err == libs.ErrUserStageNotFound {
+			fmt.Fprintf(os.Stderr, "❌ [USERS] Usuário %s sem estado salvo na sessão '%s'\n", userID, session.ID)
+			return 1
+		}
+		if err != nil {
+			return cliError("USERS", err)
+		}
+
+		if action == "reset" {
+			if err := libs.DeleteUserStage(session.ID, userID); err != nil {
+				return cliError("USERS", err)
+			}
+			fmt.Printf("✅ Estado de %s removido (estava em '%s'); a próxima mensagem começa em '%s'\n",
+				userID, userStage.CurrentStage, session.RootStage)
+			return 0
+		}
+		return showUser(session, userStage)
+
+	default:
+		fmt.Fprintf(os.Stderr, "❌ [USERS] Ação desconhecida: %s (use list, show ou reset)\n", action)
+		return 2
+	}
+}
+
+func showUser(session *libs.Session, userStage *libs.UserStage) int {
+	stageName := ""
+	if stage := libs.GetStage(userStage.CurrentStage); stage != nil {
+		stageName = " (" + stage.Name + ")"
+	}
+	fmt.Printf("Sessão:     %s\n", session.ID)
+	fmt.Printf("Usuário:    %s\n", userStage.UserID)
+	fmt.Printf("Stage:      %s%s\n", userStage.CurrentStage, stageName)
+	fmt.Printf("Idioma:     %s\n", libs.GetUserLocale(session.ID, userStage.UserID))
+	fmt.Printf("Criado:     %s\n", formatTime(userStage.CreatedAt))
+	fmt.Printf("Atualizado: %s\n", formatTime(userStage.UpdatedAt))
+
+	data, err := json.MarshalIndent(userStage.Data, "", "  ")
+	if err != nil {
+		return cliError("USERS", err)
+	}
+	fmt.Printf("Dados:      %s\n", data)
+
+	tickets, err := libs.ListTickets(libs.TicketFilter{SessionID: session.ID, UserID: userStage.UserID})
+	if err != nil {
+		return cliError("USERS", err)
+	}
+	fmt.Printf("Chamados:   %d\n", len(tickets))
+	for _, ticket := range tickets {
+		fmt.Printf("  #%d %s %s %s %s\n", ticket.ID, formatTime(ticket.CreatedAt), ticket.Kind, ticket.Status, ticket.Summary)
+	}
+	return 0
+}
+
+// StagesMain executa o subcomando "stages list": stages registrados, com os
+// usuários em cada um
+func StagesMain(cfg *config.Config, args []string) int {
+	if len(args) != 1 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "❌ [STAGES] Use: stages list")
+		return 2
+	}
+
+	cleanup, err := openStages(cfg)
+	if err != nil {
+		return cliError("STAGES", err)
+	}
+	defer cleanup()
+
+	stages := libs.GetAllStages()
+	ids := make([]string, 0, len(stages))
+	for id := range stages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	roots := make(map[string][]string)
+	for _, session := range libs.GetSessions() {
+		roots[session.RootStage] = append(roots[session.RootStage], session.ID)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNOME\tACESSO\tRAIZ DE\tUSUÁRIOS\tPRÓXIMOS")
+	for _, id := range ids {
+		stage := stages[id]
+		users := 0
+		for _, session := range libs.GetSessions() {
+			list, err := libs.ListUserStages(session.ID, id)
+			if err != nil {
+				return cliError("STAGES", err)
+			}
+			users += len(list)
+		}
+		access := "todos"
+		if stage.IsOwner {
+			access = "owners"
+		}
+		rootOf := strings.Join(roots[id], ",")
+		if rootOf == "" {
+			rootOf = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", id, stage.Name, access, rootOf, users, strings.Join(stage.NextStages, ","))
+	}
+	w.Flush()
+	return 0
+}
+
+// TicketsMain executa o subcomando "tickets list"
+func TicketsMain(cfg *config.Config, args []string) int {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "❌ [TICKETS] Use: tickets list [-status open|closed|all] [-session id] [-user número] [-kind assunto]")
+		return 2
+	}
+	flags := flag.NewFlagSet("tickets list", flag.ContinueOnError)
+	status := flags.String("status", libs.TicketOpen, "open, closed ou all")
+	sessionID := flags.String("session", "", "apenas chamados desta sessão")
+	user := flags.String("user", "", "apenas chamados deste número")
+	kind := flags.String("kind", "", "apenas chamados deste assunto (ex: emprestimo)")
+	limit := flags.Int("limit", 50, "quantidade máxima (0 = todos)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	filter := libs.TicketFilter{SessionID: *sessionID, UserID: phoneArg(*user), Kind: *kind, Status: *status, Limit: *limit}
+	switch *status {
+	case libs.TicketOpen, libs.TicketClosed:
+	case "all":
+		filter.Status = ""
+	default:
+		fmt.Fprintf(os.Stderr, "❌ [TICKETS] Status desconhecido: %s (use open, closed ou all)\n", *status)
+		return 2
+	}
+
+	cleanup, err := openStages(cfg)
+	if err != nil {
+		return cliError("TICKETS", err)
+	}
+	defer cleanup()
+
+	tickets, err := libs.ListTickets(filter)
+	if err != nil {
+		return cliError("TICKETS", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tABERTO\tSESSÃO\tUSUÁRIO\tASSUNTO\tSTATUS\tRESUMO")
+	for _, ticket := range tickets {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", ticket.ID, formatTime(ticket.CreatedAt), ticket.SessionID,
+			ticket.UserID, ticket.Kind, ticket.Status, ticket.Summary)
+	}
+	w.Flush()
+	fmt.Printf("%d chamado(s)\n", len(tickets))
+	return 0
+}
+
+// DBMain executa o subcomando "db backup": cópias consistentes do stages.db
+// e do session.db, seguras mesmo com o bot em execução
+func DBMain(cfg *config.Config, args []string) int {
+	if len(args) == 0 || args[0] != "backup" {
+		fmt.Fprintln(os.Stderr, "❌ [DB] Use: db backup [-o diretório]")
+		return 2
+	}
+	flags := flag.NewFlagSet("db backup", flag.ContinueOnError)
+	output := flags.String("o", "", "diretório de destino (padrão: DATA_DIR/backups/<data e hora>)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	dir := *output
+	if dir == "" {
+		dir = filepath.Join(cfg.DataDir, "backups", time.Now().Format("20060102-150405"))
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return cliError("DB", err)
+	}
+
+	cleanup, err := openStages(cfg)
+	if err != nil {
+		return cliError("DB", err)
+	}
+	defer cleanup()
+
+	stagesBackup := filepath.Join(dir, "stages.db")
+	if err := libs.BackupStagesDB(stagesBackup); err != nil {
+		return cliError("DB", err)
+	}
+	fmt.Printf("✅ %s\n", stagesBackup)
+
+	sessionPath := filepath.Join(cfg.SessionDir, "session.db")
+	if _, err := os.Stat(sessionPath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "⚠️ [DB] %s não existe (nenhuma sessão pareada)\n", sessionPath)
+	} else {
+		sessionBackup := filepath.Join(dir, "session.db")
+		if err := libs.BackupSQLiteFile(sessionPath, sessionBackup); err != nil {
+			return cliError("DB", err)
+		}
+		fmt.Printf("✅ %s\n", sessionBackup)
+	}
+
+	if cfg.StateStore == "postgres" || cfg.StateStore == "postgresql" {
+		fmt.Fprintln(os.Stderr, "⚠️ [DB] O estado dos usuários está no PostgreSQL (STATE_STORE=postgres); faça o backup com pg_dump")
+	}
+	return 0
+}
@@ -0,0 +1,244 @@
+package conn
+
+import (
+	"flag"
+	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
+	"hisoka/src/libs"
+	"os"
+	"strings"
+)
+
+// Carrega sessões, stages e templates sem conectar ao WhatsApp, com todo o
+// estado em memória (STATE_STORE=memory): os comandos de análise não abrem o
+// stages.db nem o banco de STATE_DATABASE_URL. Os logs da inicialização são
+// descartados.
+func loadStagesOffline(base *config.Config) (func(), error) {
+	cfg := *base
+	cfg.StateStore = "memory"
+	cfg.StateDatabaseURL = ""
+
+	err := helpers.WithoutLogs(func() error {
+		if _, err := libs.LoadSessions(&cfg); err != nil {
+			return err
+		}
+		if err := libs.InitStages(&cfg); err != nil {
+			return err
+		}
+		return libs.LoadTemplates(&cfg)
+	})
+	if err != nil {
+		libs.CloseStagesDB()
+		return nil, err
+	}
+	return func() { libs.CloseStagesDB() }, nil
+}
+
+// GraphMain executa o subcomando "graph": exporta o fluxo de atendimento
+// (stages e transições) em DOT ou Mermaid
+func GraphMain(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+	format := flags.String("format", "dot", "formato de saída: dot ou mermaid")
+	output := flags.String("o", "", "arquivo de saída (padrão: saída padrão)")
+	root := flags.String("root", "", "stages raiz separados por vírgula (padrão: o stage raiz de cada sessão)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cleanup, err := loadStagesOffline(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ [GRAPH] %s\n", err.Error())
+		return 1
+	}
+	defer cleanup()
+
+	var roots []string
+	for _, id := range strings.Split(*root, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			roots = append(roots, id)
+		}
+	}
+	graph := libs.BuildFlowGraph(roots...)
+
+	var content string
+	switch strings.ToLower(*format) {
+	case "dot", "graphviz":
+		content = graph.DOT()
+	case "mermaid", "mmd":
+		content = graph.Mermaid()
+	default:
+		fmt.Fprintf(os.Stderr, "❌ [GRAPH] Formato desconhecido: %s (use dot ou mermaid)\n", *format)
+		return 2
+	}
+
+	if *output == "" {
+		fmt.Print(content)
+	} else if err := os.WriteFile(*output, []byte(content), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ [GRAPH] %s\n", err.Error())
+		return 1
+	}
+
+	if len(graph.Missing) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ [GRAPH] Destinos não registrados: %s\n", strings.Join(graph.Missing, ", "))
+	}
+	if len(graph.Unreachable) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ [GRAPH] Stages inalcançáveis: %s\n", strings.Join(graph.Unreachable, ", "))
+	}
+	return 0
+}
+
+// LintMain executa o subcomando "lint": verifica o fluxo de atendimento e sai
+// com 1 se houver erros (ou avisos, com -strict), para uso na CI
+func LintMain(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	strict := flags.Bool("strict", false, "avisos também reprovam o lint")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cleanup, err := loadStagesOffline(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ [LINT] %s\n", err.Error())
+		return 2
+	}
+	defer cleanup()
+
+	errors, warnings := 0, 0
+	for _, issue := range libs.LintStages() {
+		fmt.Println(issue.String())
+		if issue.Warning {
+			warnings++
+		} else {
+			errors++
+		}
+	}
+
+	fmt.Printf("%d stage(s), %d erro(s), %d aviso(s)\n", len(libs.GetAllStages()), errors, warnings)
+	if errors > 0 || (*strict && warnings > 0) {
+		return 1
+	}
+	return 0
+}
+
+// Banco com migrações próprias, para o subcomando "migrate"
+type migrationTarget struct {
+	label   string
+	migrate func() error
+	status  func() ([]libs.MigrationStatus, error)
+}
+
+// MigrateMain executa o subcomando "migrate" sobre o stages.db de DATA_DIR e,
+// com STATE_STORE=postgres, sobre o banco de STATE_DATABASE_URL: "status"
+// (padrão) lista as migrações aplicadas e pendentes; "up" aplica as pendentes
+// (o bot também as aplica ao iniciar)
+func MigrateMain(cfg *config.Config, args []string) int {
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	if action != "status" && action != "up" {
+		fmt.Fprintf(os.Stderr, "❌ [MIGRATE] Ação desconhecida: %s (use status ou up)\n", action)
+		return 2
+	}
+
+	if err := libs.OpenStagesDB(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ [MIGRATE] %s\n", err.Error())
+		return 1
+	}
+	defer libs.CloseStagesDB()
+
+	databases := []migrationTarget{
+		{"stages.db", libs.Migrate, libs.MigrationsStatus},
+	}
+	if cfg.StateStore == "postgres" || cfg.StateStore == "postgresql" {
+		conn, err := libs.OpenStateDatabase(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ [MIGRATE] %s\n", err.Error())
+			return 1
+		}
+		defer conn.Close()
+		databases = append(databases, migrationTarget{
+			"STATE_DATABASE_URL",
+			func() error { return libs.MigratePostgres(conn) },
+			func() ([]libs.MigrationStatus, error) { return libs.PostgresMigrationsStatus(conn) },
+		})
+	}
+
+	code := 0
+	for i, database := range databases {
+		if len(databases) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n", database.label)
+		}
+		if action == "up" {
+			if err := database.migrate(); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ [MIGRATE] %s\n", err.Error())
+				return 1
+			}
+		}
+		statuses, err := database.status()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ [MIGRATE] %s\n", err.Error())
+			return 1
+		}
+		if !printMigrations(statuses, action == "status") {
+			code = 1
+		}
+	}
+	return code
+}
+
+// Lista as migrações (detail) e o resumo da versão; false se o banco tiver
+// migrações desconhecidas por este binário
+func printMigrations(statuses []libs.MigrationStatus, detail bool) bool {
+	current, latest, pending, unknown := 0, 0, 0, 0
+	for _, status := range statuses {
+		switch {
+		case status.Unknown:
+			unknown++
+			current = status.Version
+			if detail {
+				fmt.Printf("%04d_%s  aplicada em %s  (desconhecida por este binário)\n",
+					status.Version, status.Name, status.AppliedAt.Format("2006-01-02 15:04:05"))
+			}
+			continue
+		case status.AppliedAt.IsZero():
+			pending++
+			if detail {
+				fmt.Printf("%04d_%s  pendente\n", status.Version, status.Name)
+			}
+		default:
+			current = status.Version
+			if detail {
+				fmt.Printf("%04d_%s  aplicada em %s\n",
+					status.Version, status.Name, status.AppliedAt.Format("2006-01-02 15:04:05"))
+			}
+		}
+		latest = status.Version
+	}
+	if detail {
+		fmt.Printf("esquema na versão %d, binário na versão %d, %d pendente(s)\n", current, latest, pending)
+	} else {
+		fmt.Printf("esquema na versão %d\n", current)
+	}
+	if unknown > 0 {
+		fmt.Fprintln(os.Stderr, "❌ [MIGRATE] O banco tem migrações mais novas que este binário; o bot não vai iniciar")
+		return false
+	}
+	return true
+}
+
+// ConfigMain executa o subcomando "config": mostra a configuração efetiva
+// (arquivo + ambiente) com os segredos ocultos. Configurações inválidas já
+// são recusadas ao carregar, antes de chegar aqui.
+func ConfigMain(cfg *config.Config, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "❌ [CONFIG] Argumento desconhecido: %s\n", args[0])
+		return 2
+	}
+	cfg.Print(os.Stdout)
+	return 0
+}
@@ -0,0 +1,371 @@
+// Package config carrega a configuração do bot: valores padrão, um arquivo
+// opcional (CONFIG_FILE) e as variáveis de ambiente, que têm precedência.
+// A configuração é validada ao carregar; valores inválidos impedem o início
+// em vez de serem trocados silenciosamente pelo padrão.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hisoka/src/helpers"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ID da sessão usada quando SESSIONS não está configurado
+const DefaultSessionID = "default"
+
+// Config reúne todas as configurações do bot
+type Config struct {
+	File string // Arquivo de configuração lido ("" se nenhum)
+
+	DataDir      string // DATA_DIR: stages.db e, por padrão, mídias e informes
+	SessionDir   string // SESSION_DIR: session.db do whatsmeow
+	MediaDir     string // MEDIA_DIR (padrão: DATA_DIR/media)
+	DocumentsDir string // DOCUMENTS_DIR (padrão: DATA_DIR/informes)
+	TemplatesDir string // TEMPLATES_DIR ("" = catálogo embutido)
+	CreditLines  string // CREDIT_LINES_FILE (padrão: DATA_DIR/emprestimos.yaml)
+
+	DefaultLocale    string
+	InteractiveMenus bool
+
+	Sessions []SessionConfig
+
+	Typing      TypingConfig
+	Queue       QueueConfig
+	Transcriber TranscriberConfig
+
+	MediaMaxSize int64
+	FFprobeBin   string
+	PdftoppmBin  string
+
+	CallReplyInterval   time.Duration
+	OfflineReplayWindow time.Duration
+	ShutdownTimeout     time.Duration
+
+	StateStore       string // sqlite, postgres ou memory
+	StateDatabaseURL string // Segredo
+
+	AdminAddr       string
+	AdminToken      string // Segredo
+	AlertWebhookURL string // Segredo
+
+	Log helpers.LogConfig
+
+	// Avisos que não impedem o início (ex: variáveis obsoletas)
+	Warnings []string
+}
+
+// Configuração de uma linha de atendimento (ver SESSIONS)
+type SessionConfig struct {
+	ID            string
+	RootStage     string
+	Owners        []string
+	AllowedUsers  []string // Vazio = qualquer usuário pode ser atendido
+	PairingNumber string
+}
+
+type TypingConfig struct {
+	Enabled bool
+	PerChar time.Duration
+	Min     time.Duration
+	Max     time.Duration
+}
+
+type QueueConfig struct {
+	MinInterval  time.Duration
+	ChatInterval time.Duration
+	MaxAttempts  int
+}
+
+type TranscriberConfig struct {
+	Kind     string // "", whisper ou fake
+	Binary   string
+	Model    string
+	Language string
+	FFmpeg   string
+	Timeout  time.Duration
+	FakeText string
+}
+
+// Default retorna a configuração padrão, sem ler ambiente nem arquivo
+func Default() *Config {
+	return &Config{
+		DataDir:       ".",
+		SessionDir:    ".",
+		DefaultLocale: "pt-BR",
+		Sessions: []SessionConfig{{
+			ID:        DefaultSessionID,
+			RootStage: "default",
+		}},
+		Typing: TypingConfig{
+			PerChar: 30 * time.Millisecond,
+			Min:     500 * time.Millisecond,
+			Max:     4 * time.Second,
+		},
+		Queue: QueueConfig{
+			MinInterval:  500 * time.Millisecond,
+			ChatInterval: time.Second,
+			MaxAttempts:  8,
+		},
+		Transcriber: TranscriberConfig{
+			Binary:   "whisper-cli",
+			Language: "pt",
+			FFmpeg:   "ffmpeg",
+			Timeout:  2 * time.Minute,
+		},
+		MediaMaxSize:        10 << 20,
+		FFprobeBin:          "ffprobe",
+		PdftoppmBin:         "pdftoppm",
+		CallReplyInterval:   10 * time.Minute,
+		OfflineReplayWindow: 30 * time.Minute,
+		ShutdownTimeout:     30 * time.Second,
+		StateStore:          "sqlite",
+		Log:                 helpers.DefaultLogConfig(),
+	}
+}
+
+// Load lê o arquivo de CONFIG_FILE (se configurado) e as variáveis de
+// ambiente, e valida o resultado
+func Load() (*Config, error) {
+	src := &source{}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		src.file = values
+	}
+
+	cfg := Default()
+	if src.file != nil {
+		cfg.File = os.Getenv("CONFIG_FILE")
+	}
+	if err := cfg.apply(src); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Lê os valores do ambiente e, na falta, do arquivo; acumula os erros de
+// conversão para reportar todos de uma vez
+type source struct {
+	file map[string]string
+	errs []error
+}
+
+func (s *source) lookup(key string) (string, bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	value, ok := s.file[key]
+	return value, ok
+}
+
+func (s *source) str(key string, target *string) {
+	if value, ok := s.lookup(key); ok && strings.TrimSpace(value) != "" {
+		*target = strings.TrimSpace(value)
+	}
+}
+
+func (s *source) boolean(key string, target *bool) {
+	value, ok := s.lookup(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		return
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1", "yes", "sim":
+		*target = true
+	case "false", "0", "no", "não", "nao":
+		*target = false
+	default:
+		s.errs = append(s.errs, fmt.Errorf("%s: valor booleano inválido '%s' (use true ou false)", key, value))
+	}
+}
+
+func (s *source) duration(key string, target *time.Duration) {
+	value, ok := s.lookup(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		return
+	}
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: duração inválida '%s' (ex: 500ms, 30s, 10m)", key, value))
+		return
+	}
+	*target = parsed
+}
+
+func (s *source) integer(key string, target *int64) {
+	value, ok := s.lookup(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		return
+	}
+	parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: número inválido '%s'", key, value))
+		return
+	}
+	*target = parsed
+}
+
+func (s *source) level(key string, target *slog.Level) {
+	value, ok := s.lookup(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		return
+	}
+	parsed, err := helpers.ParseLogLevel(strings.TrimSpace(value))
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", key, err))
+		return
+	}
+	*target = parsed
+}
+
+func (c *Config) apply(s *source) error {
+	s.str("DATA_DIR", &c.DataDir)
+	s.str("SESSION_DIR", &c.SessionDir)
+	s.str("MEDIA_DIR", &c.MediaDir)
+	s.str("DOCUMENTS_DIR", &c.DocumentsDir)
+	s.str("TEMPLATES_DIR", &c.TemplatesDir)
+	s.str("CREDIT_LINES_FILE", &c.CreditLines)
+	s.str("DEFAULT_LOCALE", &c.DefaultLocale)
+	s.boolean("INTERACTIVE_MENUS", &c.InteractiveMenus)
+
+	s.boolean("TYPING_ENABLED", &c.Typing.Enabled)
+	s.duration("TYPING_PER_CHAR", &c.Typing.PerChar)
+	s.duration("TYPING_MIN", &c.Typing.Min)
+	s.duration("TYPING_MAX", &c.Typing.Max)
+
+	s.duration("SEND_MIN_INTERVAL", &c.Queue.MinInterval)
+	s.duration("SEND_CHAT_INTERVAL", &c.Queue.ChatInterval)
+	attempts := int64(c.Queue.MaxAttempts)
+	s.integer("SEND_MAX_ATTEMPTS", &attempts)
+	c.Queue.MaxAttempts = int(attempts)
+
+	if value, ok := s.lookup("TRANSCRIBER"); ok {
+		c.Transcriber.Kind = strings.ToLower(strings.TrimSpace(value))
+	}
+	s.str("WHISPER_BIN", &c.Transcriber.Binary)
+	s.str("WHISPER_MODEL", &c.Transcriber.Model)
+	s.str("WHISPER_LANGUAGE", &c.Transcriber.Language)
+	s.str("FFMPEG_BIN", &c.Transcriber.FFmpeg)
+	s.duration("TRANSCRIBE_TIMEOUT", &c.Transcriber.Timeout)
+	if value, ok := s.lookup("TRANSCRIBER_FAKE_TEXT"); ok {
+		c.Transcriber.FakeText = value
+	}
+
+	s.integer("MEDIA_MAX_SIZE", &c.MediaMaxSize)
+	s.str("FFPROBE_BIN", &c.FFprobeBin)
+	s.str("PDFTOPPM_BIN", &c.PdftoppmBin)
+
+	s.duration("CALL_REPLY_INTERVAL", &c.CallReplyInterval)
+	s.duration("OFFLINE_REPLAY_WINDOW", &c.OfflineReplayWindow)
+	s.duration("SHUTDOWN_TIMEOUT", &c.ShutdownTimeout)
+
+	if value, ok := s.lookup("STATE_STORE"); ok && strings.TrimSpace(value) != "" {
+		c.StateStore = strings.ToLower(strings.TrimSpace(value))
+	}
+	s.str("STATE_DATABASE_URL", &c.StateDatabaseURL)
+	s.str("ADMIN_ADDR", &c.AdminAddr)
+	s.str("ADMIN_TOKEN", &c.AdminToken)
+	s.str("ALERT_WEBHOOK_URL", &c.AlertWebhookURL)
+
+	s.level("LOG_LEVEL", &c.Log.Level)
+	s.level("LOG_WA_LEVEL", &c.Log.WALevel)
+	if value, ok := s.lookup("LOG_FORMAT"); ok && strings.TrimSpace(value) != "" {
+		c.Log.Format = strings.ToLower(strings.TrimSpace(value))
+	}
+	s.str("LOG_OUTPUT", &c.Log.Output)
+	s.boolean("LOG_MASK_PII", &c.Log.MaskPII)
+
+	c.applySessions(s)
+
+	for _, key := range []string{"PREFIX", "PUBLIC", "REACT_STATUS"} {
+		if _, ok := s.lookup(key); ok {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("%s não é mais usado e será ignorado", key))
+		}
+	}
+	return errors.Join(s.errs...)
+}
+
+// Sem SESSIONS, existe uma única sessão "default" configurada por OWNER,
+// ALLOWED_USERS e PAIRING_NUMBER. Com SESSIONS=atendimento,cobranca, cada
+// sessão é configurada por SESSION_<ID>_ROOT_STAGE, SESSION_<ID>_OWNER,
+// SESSION_<ID>_ALLOWED_USERS e SESSION_<ID>_PAIRING_NUMBER.
+func (c *Config) applySessions(s *source) {
+	value, _ := s.lookup("SESSIONS")
+	ids := splitList(value)
+	if len(ids) == 0 {
+		allowed, _ := s.lookup("ALLOWED_USERS")
+		if strings.TrimSpace(allowed) == "" {
+			c.Warnings = append(c.Warnings, "ALLOWED_USERS não definido: qualquer número será atendido")
+		}
+		owners, _ := s.lookup("OWNER")
+		pairing, _ := s.lookup("PAIRING_NUMBER")
+		c.Sessions = []SessionConfig{{
+			ID:            DefaultSessionID,
+			RootStage:     "default",
+			Owners:        splitList(owners),
+			AllowedUsers:  allowedList(allowed),
+			PairingNumber: strings.TrimSpace(pairing),
+		}}
+		return
+	}
+
+	c.Sessions = nil
+	for _, id := range ids {
+		id = strings.ToLower(id)
+		prefix := "SESSION_" + strings.ToUpper(id) + "_"
+		rootStage, _ := s.lookup(prefix + "ROOT_STAGE")
+		if strings.TrimSpace(rootStage) == "" {
+			rootStage = "default"
+		}
+		owners, _ := s.lookup(prefix + "OWNER")
+		allowed, _ := s.lookup(prefix + "ALLOWED_USERS")
+		pairing, _ := s.lookup(prefix + "PAIRING_NUMBER")
+		c.Sessions = append(c.Sessions, SessionConfig{
+			ID:            id,
+			RootStage:     strings.TrimSpace(rootStage),
+			Owners:        splitList(owners),
+			AllowedUsers:  allowedList(allowed),
+			PairingNumber: strings.TrimSpace(pairing),
+		})
+	}
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Lista de números autorizados; "*" libera o atendimento para todos
+func allowedList(value string) []string {
+	if strings.TrimSpace(value) == "*" {
+		return nil
+	}
+	return splitList(value)
+}
+
+var (
+	nonDigits     = regexp.MustCompile(`\D+`)
+	sessionIDChar = regexp.MustCompile(`^[a-z0-9_-]+$`)
+)
+
+// Normaliza um número de telefone (apenas dígitos, com DDI: 10 a 15 dígitos)
+func normalizePhone(value string) (string, bool) {
+	digits := nonDigits.ReplaceAllString(value, "")
+	return digits, len(digits) >= 10 && len(digits) <= 15
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Valor exibido no lugar de segredos
+const redacted = "********"
+
+// Item da configuração efetiva, na forma de variável de ambiente
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// Entries lista a configuração efetiva com os segredos ocultos
+func (c *Config) Entries() []Entry {
+	var entries []Entry
+	add := func(key string, value string) {
+		entries = append(entries, Entry{Key: key, Value: value})
+	}
+	duration := func(key string, value time.Duration) {
+		add(key, value.String())
+	}
+
+	add("CONFIG_FILE", c.File)
+	add("DATA_DIR", c.DataDir)
+	add("SESSION_DIR", c.SessionDir)
+	add("MEDIA_DIR", c.MediaDir)
+	add("DOCUMENTS_DIR", c.DocumentsDir)
+	add("TEMPLATES_DIR", c.TemplatesDir)
+	add("CREDIT_LINES_FILE", c.CreditLines)
+	add("DEFAULT_LOCALE", c.DefaultLocale)
+	add("INTERACTIVE_MENUS", strconv.FormatBool(c.InteractiveMenus))
+
+	if len(c.Sessions) == 1 && c.Sessions[0].ID == DefaultSessionID {
+		session := c.Sessions[0]
+		add("OWNER", strings.Join(session.Owners, ","))
+		add("ALLOWED_USERS", allowedString(session.AllowedUsers))
+		add("PAIRING_NUMBER", session.PairingNumber)
+	} else {
+		ids := make([]string, len(c.Sessions))
+		for i, session := range c.Sessions {
+			ids[i] = session.ID
+		}
+		add("SESSIONS", strings.Join(ids, ","))
+		for _, session := range c.Sessions {
+			prefix := "SESSION_" + strings.ToUpper(session.ID) + "_"
+			add(prefix+"ROOT_STAGE", session.RootStage)
+			add(prefix+"OWNER", strings.Join(session.Owners, ","))
+			add(prefix+"ALLOWED_USERS", allowedString(session.AllowedUsers))
+			add(prefix+"PAIRING_NUMBER", session.PairingNumber)
+		}
+	}
+
+	add("TYPING_ENABLED", strconv.FormatBool(c.Typing.Enabled))
+	duration("TYPING_PER_CHAR", c.Typing.PerChar)
+	duration("TYPING_MIN", c.Typing.Min)
+	duration("TYPING_MAX", c.Typing.Max)
+	duration("SEND_MIN_INTERVAL", c.Queue.MinInterval)
+	duration("SEND_CHAT_INTERVAL", c.Queue.ChatInterval)
+	add("SEND_MAX_ATTEMPTS", strconv.Itoa(c.Queue.MaxAttempts))
+
+	add("TRANSCRIBER", c.Transcriber.Kind)
+	if c.Transcriber.Kind == "whisper" {
+		add("WHISPER_BIN", c.Transcriber.Binary)
+		add("WHISPER_MODEL", c.Transcriber.Model)
+		add("WHISPER_LANGUAGE", c.Transcriber.Language)
+		duration("TRANSCRIBE_TIMEOUT", c.Transcriber.Timeout)
+	}
+	add("FFMPEG_BIN", c.Transcriber.FFmpeg)
+	add("FFPROBE_BIN", c.FFprobeBin)
+	add("PDFTOPPM_BIN", c.PdftoppmBin)
+	add("MEDIA_MAX_SIZE", strconv.FormatInt(c.MediaMaxSize, 10))
+
+	duration("CALL_REPLY_INTERVAL", c.CallReplyInterval)
+	duration("OFFLINE_REPLAY_WINDOW", c.OfflineReplayWindow)
+	duration("SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+
+	add("STATE_STORE", c.StateStore)
+	add("STATE_DATABASE_URL", redactURL(c.StateDatabaseURL))
+	add("ADMIN_ADDR", c.AdminAddr)
+	add("ADMIN_TOKEN", redactSecret(c.AdminToken))
+	add("ALERT_WEBHOOK_URL", redactURL(c.AlertWebhookURL))
+
+	add("LOG_LEVEL", strings.ToLower(c.Log.Level.String()))
+	add("LOG_FORMAT", c.Log.Format)
+	add("LOG_OUTPUT", c.Log.Output)
+	add("LOG_MASK_PII", strconv.FormatBool(c.Log.MaskPII))
+	add("LOG_WA_LEVEL", strings.ToLower(c.Log.WALevel.String()))
+	return entries
+}
+
+// Print escreve a configuração efetiva (KEY=valor), com os segredos ocultos
+func (c *Config) Print(w io.Writer) {
+	for _, entry := range c.Entries() {
+		fmt.Fprintf(w, "%s=%s\n", entry.Key, entry.Value)
+	}
+	for _, warning := range c.Warnings {
+		fmt.Fprintf(w, "# aviso: %s\n", warning)
+	}
+}
+
+func allowedString(allowed []string) string {
+	if len(allowed) == 0 {
+		return "*"
+	}
+	return strings.Join(allowed, ",")
+}
+
+func redactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// Mantém esquema e host; oculta senha, caminho e parâmetros (webhooks
+// costumam carregar o token no caminho)
+func redactURL(value string) string {
+	if value == "" {
+		return ""
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return redacted
+	}
+	result := parsed.Scheme + "://"
+	if parsed.User != nil {
+		result += parsed.User.Username() + ":" + redacted + "@"
+	}
+	result += parsed.Host
+	if parsed.Path != "" && parsed.Path != "/" {
+		result += "/" + redacted
+	}
+	return result
+}
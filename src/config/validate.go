@@ -0,0 +1,182 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Validate verifica a configuração e normaliza os números de telefone.
+// Todos os problemas encontrados são reportados juntos.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	seen := make(map[string]bool)
+	for i := range c.Sessions {
+		session := &c.Sessions[i]
+		prefix := sessionPrefix(c, session.ID)
+		if !sessionIDChar.MatchString(session.ID) {
+			fail("SESSIONS: ID de sessão inválido '%s' (use letras minúsculas, números, _ ou -)", session.ID)
+		}
+		if seen[session.ID] {
+			fail("sessão '%s' declarada mais de uma vez em SESSIONS", session.ID)
+		}
+		seen[session.ID] = true
+
+		for j, owner := range session.Owners {
+			phone, ok := normalizePhone(owner)
+			if !ok {
+				fail("%sOWNER: número inválido '%s' (use o número com DDI, ex: 5511999999999)", prefix, owner)
+			}
+			session.Owners[j] = phone
+		}
+		for j, allowed := range session.AllowedUsers {
+			phone, ok := normalizePhone(allowed)
+			if !ok {
+				fail("%sALLOWED_USERS: número inválido '%s' (use o número com DDI ou * para todos)", prefix, allowed)
+			}
+			session.AllowedUsers[j] = phone
+		}
+		if session.PairingNumber != "" {
+			phone, ok := normalizePhone(session.PairingNumber)
+			if !ok {
+				fail("%sPAIRING_NUMBER: número inválido '%s'", prefix, session.PairingNumber)
+			}
+			session.PairingNumber = phone
+		}
+		if session.RootStage == "" {
+			fail("%sROOT_STAGE vazio", prefix)
+		}
+	}
+
+	for _, dir := range []struct{ key, path string }{
+		{"DATA_DIR", c.DataDir},
+		{"SESSION_DIR", c.SessionDir},
+		{"MEDIA_DIR", c.MediaDir},
+	} {
+		if err := checkDir(dir.path, false); err != nil {
+			fail("%s: %s", dir.key, err.Error())
+		}
+	}
+	for _, dir := range []struct{ key, path string }{
+		{"DOCUMENTS_DIR", c.DocumentsDir},
+		{"TEMPLATES_DIR", c.TemplatesDir},
+	} {
+		if err := checkDir(dir.path, true); err != nil {
+			fail("%s: %s", dir.key, err.Error())
+		}
+	}
+
+	if c.CreditLines != "" {
+		if info, err := os.Stat(c.CreditLines); err != nil {
+			fail("CREDIT_LINES_FILE: %s", err.Error())
+		} else if info.IsDir() {
+			fail("CREDIT_LINES_FILE: '%s' é um diretório", c.CreditLines)
+		}
+	}
+
+	if c.DefaultLocale == "" {
+		fail("DEFAULT_LOCALE vazio")
+	}
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"TYPING_PER_CHAR", c.Typing.PerChar},
+		{"TYPING_MIN", c.Typing.Min},
+		{"TYPING_MAX", c.Typing.Max},
+		{"SEND_MIN_INTERVAL", c.Queue.MinInterval},
+		{"SEND_CHAT_INTERVAL", c.Queue.ChatInterval},
+		{"TRANSCRIBE_TIMEOUT", c.Transcriber.Timeout},
+		{"CALL_REPLY_INTERVAL", c.CallReplyInterval},
+		{"OFFLINE_REPLAY_WINDOW", c.OfflineReplayWindow},
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+	} {
+		if d.value < 0 {
+			fail("%s não pode ser negativo (%s)", d.key, d.value)
+		}
+	}
+	if c.Typing.Min > c.Typing.Max {
+		fail("TYPING_MIN (%s) maior que TYPING_MAX (%s)", c.Typing.Min, c.Typing.Max)
+	}
+	if c.Transcriber.Kind == "whisper" && c.Transcriber.Timeout == 0 {
+		fail("TRANSCRIBE_TIMEOUT deve ser maior que zero")
+	}
+	if c.ShutdownTimeout == 0 {
+		fail("SHUTDOWN_TIMEOUT deve ser maior que zero")
+	}
+	if c.Queue.MaxAttempts <= 0 {
+		fail("SEND_MAX_ATTEMPTS deve ser maior que zero")
+	}
+	if c.MediaMaxSize <= 0 {
+		fail("MEDIA_MAX_SIZE deve ser maior que zero")
+	}
+
+	switch c.Transcriber.Kind {
+	case "", "fake":
+	case "whisper":
+		if c.Transcriber.Model == "" {
+			fail("TRANSCRIBER=whisper requer WHISPER_MODEL")
+		}
+	default:
+		fail("TRANSCRIBER inválido: %s (use whisper, fake ou vazio)", c.Transcriber.Kind)
+	}
+
+	switch c.StateStore {
+	case "sqlite", "sqlite3", "memory":
+	case "postgres", "postgresql":
+		if c.StateDatabaseURL == "" {
+			fail("STATE_STORE=postgres requer STATE_DATABASE_URL")
+		}
+	default:
+		fail("STATE_STORE desconhecido: %s (use sqlite, postgres ou memory)", c.StateStore)
+	}
+
+	if c.AdminAddr != "" && c.AdminToken == "" {
+		fail("ADMIN_ADDR configurado sem ADMIN_TOKEN")
+	}
+	if c.AlertWebhookURL != "" && !strings.HasPrefix(c.AlertWebhookURL, "http://") && !strings.HasPrefix(c.AlertWebhookURL, "https://") {
+		fail("ALERT_WEBHOOK_URL deve começar com http:// ou https://")
+	}
+
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		fail("LOG_FORMAT desconhecido: %s (use text ou json)", c.Log.Format)
+	}
+	return errors.Join(errs...)
+}
+
+// Prefixo das variáveis da sessão nas mensagens de erro
+func sessionPrefix(c *Config, id string) string {
+	if len(c.Sessions) == 1 && id == DefaultSessionID {
+		return ""
+	}
+	return "SESSION_" + strings.ToUpper(id) + "_"
+}
+
+// Diretórios que não existem são criados ao iniciar, exceto os que precisam
+// ter conteúdo (mustExist)
+func checkDir(path string, mustExist bool) error {
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if mustExist {
+			return fmt.Errorf("diretório '%s' não existe", path)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' não é um diretório", path)
+	}
+	return nil
+}
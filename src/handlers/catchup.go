@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"hisoka/src/helpers"
+	"hisoka/src/libs"
+	"sync"
+	"time"
+)
+
+// Quanto tempo esperar sem novas mensagens offline antes de processar o
+// lote, caso o evento OfflineSyncCompleted não chegue
+var catchUpQuietPeriod = 10 * time.Second
+
+// Política de recuperação das mensagens recebidas enquanto o bot estava
+// offline: mensagens dentro da janela são respondidas (apenas a última de
+// cada membro) e as mais antigas recebem um pedido de desculpas com o menu
+type CatchUp struct {
+	Window time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingMessage
+	order   []string
+	timer   *time.Timer
+}
+
+type pendingMessage struct {
+	sock *libs.IClient
+	m    *libs.IMessage
+}
+
+// NewCatchUp cria a política com a janela de OFFLINE_REPLAY_WINDOW
+func NewCatchUp(window time.Duration) *CatchUp {
+	return &CatchUp{
+		Window:  window,
+		pending: make(map[string]*pendingMessage),
+	}
+}
+
+// Add guarda a mensagem offline, mantendo apenas a mais recente de cada membro
+func (c *CatchUp) Add(sock *libs.IClient, m *libs.IMessage) {
+	key := m.Info.Chat.String() + "|" + m.Sender.ToNonAD().User
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if current, ok := c.pending[key]; ok {
+		if m.Info.Timestamp.Before(current.m.Info.Timestamp) {
+			return
+		}
+	} else {
+		c.order = append(c.order, key)
+	}
+	c.pending[key] = &pendingMessage{sock: sock, m: m}
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(catchUpQuietPeriod, c.Flush)
+}
+
+// Flush processa as mensagens guardadas. É chamado quando a sincronização
+// offline termina ou após o período sem novas mensagens.
+func (c *CatchUp) Flush() {
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	batch := make([]*pendingMessage, 0, len(c.order))
+	for _, key := range c.order {
+		batch = append(batch, c.pending[key])
+	}
+	c.pending = make(map[string]*pendingMessage)
+	c.order = nil
+	c.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	helpers.Logger("catchup").Info("Processando mensagens recebidas offline", "members", len(batch))
+
+	for _, item := range batch {
+		item := item
+		user := item.m.Sender.ToNonAD().User
+		done, ok := libs.BeginWork(fmt.Sprintf("mensagem offline %s de %s", item.m.Info.ID, user))
+		if !ok {
+			return
+		}
+
+		age := time.Since(item.m.Info.Timestamp)
+		go func() {
+			defer done()
+			if age <= c.Window {
+				item.m.Log.Info("Respondendo mensagem offline", "component", "catchup", "age", age.Round(time.Second).String())
+				ProcessStageMessage(item.sock, item.m)
+				return
+			}
+			item.m.Log.Info("Mensagem offline antiga, enviando desculpas e menu", "component", "catchup", "age", age.Round(time.Second).String())
+			replyStale(item.sock, item.m)
+		}()
+	}
+}
+
+// Envia o pedido de desculpas e recomeça o atendimento pelo menu principal
+func replyStale(sock *libs.IClient, m *libs.IMessage) {
+	if !sock.Session.IsAuthorized(m.Sender.ToNonAD().User) {
+		return
+	}
+
+	m.Reply(sock.Render(m, "desculpas_offline", nil))
+
+	if err := libs.ChangeUserStage(sock.Session.ID, m.Sender.ToNonAD().User, sock.Session.RootStage); err != nil {
+		m.Log.Error("Erro ao voltar para o menu", "component", "catchup", "error", err)
+		return
+	}
+
+	// Sem texto o menu principal é exibido
+	m.Body = ""
+	m.Text = ""
+	m.Args = nil
+	ProcessStageMessage(sock, m)
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
 	"hisoka/src/libs"
 	"time"
 
@@ -11,40 +13,101 @@ import (
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
-	waLog "go.mau.fi/whatsmeow/util/log"
 )
 
 type IHandler struct {
-	Container *store.Device
-}
+	Container  *store.Device
+	Session    *libs.Session
+	Supervisor *Supervisor
+	CatchUp    *CatchUp
 
-// Timestamp de quando o bot foi inicializado
-var botStartupTime = time.Now()
+	// Início da sessão: mensagens anteriores foram recebidas offline e seguem
+	// a política de recuperação (CatchUp)
+	StartedAt time.Time
+}
 
-func NewHandler(container *sqlstore.Container) *IHandler {
-	// Define o timestamp de inicialização do bot
-	botStartupTime = time.Now()
-	
+func NewHandler(container *sqlstore.Container, session *libs.Session, cfg *config.Config) *IHandler {
 	ctx := context.Background()
-	deviceStore, err := container.GetFirstDevice(ctx)
+	deviceStore, err := SessionDevice(ctx, container, session)
 	if err != nil {
 		panic(err)
 	}
 	return &IHandler{
 		Container: deviceStore,
+		Session:   session,
+		CatchUp:   NewCatchUp(cfg.OfflineReplayWindow),
+		StartedAt: time.Now(),
+	}
+}
+
+// SessionDevice obtém o dispositivo da sessão. Sessões ainda não vinculadas
+// aproveitam um dispositivo pareado que não pertença a outra sessão
+// (instalações com uma única sessão) ou recebem um dispositivo novo, que
+// precisará ser pareado.
+func SessionDevice(ctx context.Context, container *sqlstore.Container, session *libs.Session) (*store.Device, error) {
+	jid, err := libs.GetSessionDevice(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if jid != "" {
+		parsed, err := types.ParseJID(jid)
+		if err != nil {
+			return nil, err
+		}
+		device, err := container.GetDevice(ctx, parsed)
+		if err != nil {
+			return nil, err
+		}
+		if device != nil {
+			return device, nil
+		}
+		// Dispositivo removido (logout): será necessário parear novamente
+		return container.NewDevice(), nil
+	}
+
+	bound := make(map[string]bool)
+	for _, other := range libs.GetSessions() {
+		if other.ID == session.ID {
+			continue
+		}
+		otherJID, err := libs.GetSessionDevice(other.ID)
+		if err != nil {
+			return nil, err
+		}
+		bound[otherJID] = true
+	}
+
+	devices, err := container.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
 	}
+	for _, device := range devices {
+		if device.ID != nil && !bound[device.ID.String()] {
+			return device, libs.SaveSessionDevice(session.ID, device.ID.String())
+		}
+	}
+	return container.NewDevice(), nil
 }
 
 func (h *IHandler) Client() *whatsmeow.Client {
-	clientLog := waLog.Stdout("lient", "ERROR", true)
+	clientLog := helpers.WALogger("Client/" + h.Session.ID)
 	conn := whatsmeow.NewClient(h.Container, clientLog)
+	h.Supervisor = NewSupervisor(conn, h.Session)
+	libs.StartSendQueue(conn, h.Session)
 	conn.AddEventHandler(h.RegisterHandler(conn))
 	return conn
 }
 
 func (h *IHandler) RegisterHandler(conn *whatsmeow.Client) func(evt interface{}) {
 	return func(evt interface{}) {
-		sock := libs.SerializeClient(conn)
+		// Durante o desligamento nenhum evento novo é aceito
+		if libs.IsDraining() {
+			return
+		}
+		if h.Supervisor != nil {
+			h.Supervisor.HandleEvent(evt)
+		}
+		sock := libs.SerializeClient(conn, h.Session)
 		switch v := evt.(type) {
 		case *events.Message:
 			m := libs.SerializeMessage(v, sock)
@@ -54,27 +117,39 @@ func (h *IHandler) RegisterHandler(conn *whatsmeow.Client) func(evt interface{})
 				return
 			}
 
-			// Filtra mensagens antigas (enviadas antes do bot estar online)
+			// Mensagens enviadas antes do bot estar online seguem a política de recuperação
 			messageTime := v.Info.Timestamp
-			if messageTime.Before(botStartupTime) {
-				fmt.Printf("\x1b[90m[IGNORADA] Mensagem antiga de %s (%s) - enviada em %s\x1b[39m\n", 
-					v.Info.PushName, v.Info.Sender.User, messageTime.Format("15:04:05"))
+			if messageTime.Before(h.StartedAt) {
+				m.Log.Info("Mensagem recebida offline", "message_id", v.Info.ID, "sent_at", messageTime.Format(time.RFC3339))
+				h.CatchUp.Add(sock, m)
 				return
 			}
 
-			// log
+			// O texto não é registrado: pode trazer CPF, data de nascimento e
+			// outros dados pessoais que LOG_MASK_PII não reconhece
 			if m.Body != "" {
-				fmt.Println("\x1b[94mFrom :", v.Info.PushName, m.Info.Sender.User, "\x1b[39m")
-				if len(m.Body) < 350 {
-					fmt.Print("\x1b[92mMessage : ", m.Body, "\x1b[39m", "\n")
-				} else {
-					fmt.Print("\x1b[92mMessage : ", m.Info.Type, "\x1b[39m", "\n")
-				}
+				m.Log.Info("Mensagem recebida", "message_id", v.Info.ID, "type", m.Info.Type, "length", len(m.Body))
+			}
+
+			// Registra o processamento para que o desligamento aguarde o término
+			done, ok := libs.BeginWork(fmt.Sprintf("mensagem %s de %s", v.Info.ID, m.Sender.ToNonAD().User))
+			if !ok {
+				m.Log.Info("Desligando, mensagem não será processada", "message_id", v.Info.ID)
+				return
 			}
 
 			// Process stage message
-			go ProcessStageMessage(sock, m)
+			go func() {
+				defer done()
+				ProcessStageMessage(sock, m)
+			}()
 			return
+		case *events.CallOffer:
+			h.handleCall(sock, v.BasicCallMeta)
+		case *events.CallOfferNotice:
+			h.handleCall(sock, v.BasicCallMeta)
+		case *events.OfflineSyncCompleted:
+			h.CatchUp.Flush()
 		case *events.Connected, *events.PushNameSetting:
 			if len(conn.Store.PushName) == 0 {
 				return
@@ -89,7 +164,14 @@ func ProcessStageMessage(c *libs.IClient, m *libs.IMessage) {
 	libs.ProcessStageMessage(c, m)
 }
 
-// GetBotStartupTime retorna o timestamp de quando o bot foi inicializado
-func GetBotStartupTime() time.Time {
-	return botStartupTime
+// Recusa a chamada e responde ao membro em segundo plano
+func (h *IHandler) handleCall(sock *libs.IClient, call types.BasicCallMeta) {
+	done, ok := libs.BeginWork(fmt.Sprintf("chamada %s de %s", call.CallID, call.From.User))
+	if !ok {
+		return
+	}
+	go func() {
+		defer done()
+		libs.HandleCallOffer(sock, call)
+	}()
 }
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"fmt"
+	"hisoka/src/helpers"
+	"hisoka/src/libs"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Tempo que o bot pode ficar desconectado (aguardando a reconexão automática
+// do whatsmeow) antes do supervisor assumir e alertar os owners
+var disconnectGrace = 2 * time.Minute
+
+// Limites do backoff de reconexão
+var (
+	reconnectMinDelay = 5 * time.Second
+	reconnectMaxDelay = 5 * time.Minute
+)
+
+// Supervisor acompanha os eventos de conexão, reconecta com backoff quando
+// possível, avisa os owners quando a sessão é perdida e registra o histórico
+type Supervisor struct {
+	conn    *whatsmeow.Client
+	session *libs.Session
+
+	mu             sync.Mutex
+	connected      bool
+	disconnectedAt time.Time
+	reconnecting   bool
+	sessionLost    bool
+	watchdog       *time.Timer
+}
+
+func NewSupervisor(conn *whatsmeow.Client, session *libs.Session) *Supervisor {
+	return &Supervisor{conn: conn, session: session}
+}
+
+// HandleEvent processa os eventos de conexão; os demais eventos são ignorados
+func (s *Supervisor) HandleEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Connected:
+		s.onConnected()
+
+	case *events.Disconnected:
+		s.record(libs.ConnEventDisconnected, "")
+		s.onDisconnected()
+
+	case *events.KeepAliveTimeout:
+		s.record(libs.ConnEventKeepAlive, fmt.Sprintf("erros=%d último=%s", v.ErrorCount, v.LastSuccess.Format(time.RFC3339)))
+
+	case *events.LoggedOut:
+		detail := fmt.Sprintf("motivo=%s on_connect=%v", v.Reason.String(), v.OnConnect)
+		s.record(libs.ConnEventLoggedOut, detail)
+		if err := libs.DeleteSessionDevice(s.session.ID); err != nil {
+			s.log().Error("Erro ao desvincular dispositivo", "error", err)
+		}
+		s.loseSession("Sessão do WhatsApp encerrada", "O número foi desconectado (logout). É necessário parear novamente. "+detail)
+
+	case *events.StreamReplaced:
+		s.record(libs.ConnEventStreamReplaced, "")
+		s.loseSession("Sessão do WhatsApp substituída", "Outra instância conectou com a mesma sessão. Este processo não vai reconectar para não disputar a sessão.")
+
+	case *events.TemporaryBan:
+		detail := fmt.Sprintf("código=%s expira_em=%s", v.Code.String(), v.Expire)
+		s.record(libs.ConnEventTemporaryBan, detail)
+		s.notify("Número banido temporariamente", v.String())
+		s.scheduleReconnect(v.Expire)
+
+	case *events.ConnectFailure:
+		detail := fmt.Sprintf("motivo=%d %s", v.Reason, v.Message)
+		s.record(libs.ConnEventConnectFailure, detail)
+		if v.Reason.IsLoggedOut() {
+			// O evento LoggedOut correspondente cuida do alerta
+			return
+		}
+		s.onDisconnected()
+
+	case *events.ClientOutdated:
+		s.record(libs.ConnEventClientOutdated, "")
+		s.loseSession("Cliente desatualizado", "O WhatsApp recusou a conexão por versão desatualizada do whatsmeow. Atualize a dependência.")
+	}
+}
+
+func (s *Supervisor) onConnected() {
+	// Vincula o dispositivo à sessão (necessário após um novo pareamento)
+	if s.conn.Store.ID != nil {
+		if err := libs.SaveSessionDevice(s.session.ID, s.conn.Store.ID.String()); err != nil {
+			s.log().Error("Erro ao vincular dispositivo", "error", err)
+		}
+	}
+
+	s.mu.Lock()
+	wasDown := !s.disconnectedAt.IsZero()
+	downtime := time.Since(s.disconnectedAt)
+	s.connected = true
+	s.disconnectedAt = time.Time{}
+	s.sessionLost = false
+	if s.watchdog != nil {
+		s.watchdog.Stop()
+		s.watchdog = nil
+	}
+	s.mu.Unlock()
+
+	if wasDown {
+		s.record(libs.ConnEventConnected, fmt.Sprintf("reconectado após %s", downtime.Round(time.Second)))
+	} else {
+		s.record(libs.ConnEventConnected, "")
+	}
+}
+
+// Inicia o watchdog: se o whatsmeow não reconectar sozinho dentro do prazo,
+// o supervisor alerta os owners e passa a reconectar com backoff
+func (s *Supervisor) onDisconnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connected = false
+	if s.sessionLost {
+		return
+	}
+	if s.disconnectedAt.IsZero() {
+		s.disconnectedAt = time.Now()
+	}
+	if s.watchdog != nil {
+		return
+	}
+	s.watchdog = time.AfterFunc(disconnectGrace, func() {
+		s.mu.Lock()
+		s.watchdog = nil
+		stillDown := !s.connected && !s.sessionLost
+		since := s.disconnectedAt
+		s.mu.Unlock()
+
+		if !stillDown || libs.IsDraining() {
+			return
+		}
+		s.notify("WhatsApp desconectado", fmt.Sprintf("Sem conexão desde %s, tentando reconectar.", since.Format(time.RFC3339)))
+		s.reconnectLoop()
+	})
+}
+
+// Marca a sessão como perdida (sem reconexão) e avisa os owners
+func (s *Supervisor) loseSession(subject string, detail string) {
+	s.mu.Lock()
+	s.connected = false
+	s.sessionLost = true
+	if s.watchdog != nil {
+		s.watchdog.Stop()
+		s.watchdog = nil
+	}
+	s.mu.Unlock()
+
+	s.notify(subject, detail)
+}
+
+// Agenda uma tentativa de reconexão para quando o banimento expirar
+func (s *Supervisor) scheduleReconnect(after time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connected = false
+	if after <= 0 {
+		// Banimento sem prazo informado: tenta novamente mais tarde
+		after = time.Hour
+	}
+	if s.watchdog != nil {
+		s.watchdog.Stop()
+	}
+	s.watchdog = time.AfterFunc(after, func() {
+		s.mu.Lock()
+		s.watchdog = nil
+		s.mu.Unlock()
+		s.reconnectLoop()
+	})
+}
+
+// Tenta reconectar com backoff exponencial até conseguir, até a sessão ser
+// perdida ou até o processo começar a desligar
+func (s *Supervisor) reconnectLoop() {
+	s.mu.Lock()
+	if s.reconnecting {
+		s.mu.Unlock()
+		return
+	}
+	s.reconnecting = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.reconnecting = false
+		s.mu.Unlock()
+	}()
+
+	delay := reconnectMinDelay
+	for attempt := 1; ; attempt++ {
+		s.mu.Lock()
+		done := s.connected || s.sessionLost
+		s.mu.Unlock()
+		if done || libs.IsDraining() {
+			return
+		}
+
+		s.record(libs.ConnEventReconnecting, fmt.Sprintf("tentativa %d", attempt))
+		s.conn.Disconnect()
+		err := s.conn.Connect()
+		if err == nil {
+			return
+		}
+		s.log().Warn("Falha ao reconectar", "attempt", attempt, "error", err)
+
+		time.Sleep(delay)
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+func (s *Supervisor) log() *slog.Logger {
+	return helpers.Logger("supervisor").With("session", s.session.ID)
+}
+
+func (s *Supervisor) record(event string, detail string) {
+	s.log().Info("Evento de conexão", "event", event, "detail", detail)
+	if err := libs.RecordConnectionEvent(s.session.ID, event, detail); err != nil {
+		s.log().Error("Erro ao registrar evento de conexão", "error", err)
+	}
+}
+
+func (s *Supervisor) notify(subject string, detail string) {
+	if err := libs.NotifyOwners(s.session, subject, detail); err != nil {
+		s.log().Error("Erro ao enviar alerta", "error", err)
+	}
+}
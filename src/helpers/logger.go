@@ -1,37 +1,258 @@
 package helpers
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
 )
 
+// Configuração do log (LOG_LEVEL, LOG_FORMAT, LOG_OUTPUT, LOG_MASK_PII e
+// LOG_WA_LEVEL)
+type LogConfig struct {
+	Level   slog.Level
+	Format  string // "text" ou "json"
+	Output  string // "stdout", "stderr" ou caminho de arquivo
+	MaskPII bool   // Mascara telefones e CPFs nas mensagens e atributos
+	// Nível mínimo dos logs internos do whatsmeow (muito verbosos em debug)
+	WALevel slog.Level
+}
+
 var (
-	WarningLogger *log.Logger
-	InfoLogger    *log.Logger
-	ErrorLogger   *log.Logger
+	logger    atomic.Pointer[slog.Logger]
+	waLevel   atomic.Int64
+	logOutput io.Closer
+	// Os handlers escrevem aqui; o destino (LOG_OUTPUT) pode ser trocado sem
+	// recriar o logger (ver WithoutLogs)
+	sink = &logSink{out: os.Stdout}
 )
 
-type Logger struct{}
-
 func init() {
-	file, err := os.OpenFile("logs.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		log.Fatal(err)
+	config := DefaultLogConfig()
+	logger.Store(slog.New(newLogHandler(config, sink)))
+	waLevel.Store(int64(config.WALevel))
+}
+
+// Log retorna o logger do bot
+func Log() *slog.Logger {
+	return logger.Load()
+}
+
+func DefaultLogConfig() LogConfig {
+	return LogConfig{
+		Level:   slog.LevelInfo,
+		Format:  "text",
+		Output:  "stdout",
+		MaskPII: true,
+		WALevel: slog.LevelWarn,
+	}
+}
+
+// ParseLogLevel aceita debug, info, warn e error
+func ParseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToLower(value))); err != nil {
+		return level, fmt.Errorf("nível desconhecido: %s (use debug, info, warn ou error)", value)
+	}
+	return level, nil
+}
+
+// SetupLogger substitui o logger do bot de acordo com a configuração
+func SetupLogger(config LogConfig) error {
+	if config.Format != "text" && config.Format != "json" {
+		return fmt.Errorf("formato de log desconhecido: %s (use text ou json)", config.Format)
+	}
+
+	var out io.Writer
+	var closer io.Closer
+	switch config.Output {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		if err := os.MkdirAll(filepath.Dir(config.Output), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(config.Output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			return err
+		}
+		out, closer = file, file
+	}
+
+	sink.swap(out)
+	logger.Store(slog.New(newLogHandler(config, sink)))
+	waLevel.Store(int64(config.WALevel))
+	if logOutput != nil {
+		logOutput.Close()
+	}
+	logOutput = closer
+	return nil
+}
+
+func newLogHandler(config LogConfig, out io.Writer) slog.Handler {
+	options := &slog.HandlerOptions{Level: config.Level}
+	var handler slog.Handler
+	if config.Format == "json" {
+		handler = slog.NewJSONHandler(out, options)
+	} else {
+		handler = slog.NewTextHandler(out, options)
+	}
+	if config.MaskPII {
+		handler = &maskingHandler{next: handler}
+	}
+	return handler
+}
+
+// Destino dos logs, trocado por SetupLogger e WithoutLogs
+type logSink struct {
+	mu  sync.RWMutex
+	out io.Writer
+}
+
+func (s *logSink) Write(p []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.out.Write(p)
+}
+
+// Troca o destino e retorna o anterior
+func (s *logSink) swap(out io.Writer) io.Writer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.out
+	s.out = out
+	return previous
+}
+
+// WithoutLogs executa fn descartando os logs do bot (ex: os da inicialização
+// do motor nos comandos da CLI e no simulador)
+func WithoutLogs(fn func() error) error {
+	previous := sink.swap(io.Discard)
+	defer sink.swap(previous)
+	return fn()
+}
+
+// NewCorrelationID gera o identificador que acompanha os logs de uma mensagem
+func NewCorrelationID() string {
+	buf := make([]byte, 6)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+var (
+	cpfPattern   = regexp.MustCompile(`\b\d{3}\.\d{3}\.\d{3}-\d{2}\b`)
+	phonePattern = regexp.MustCompile(`\+?\b\d{10,15}\b`)
+)
+
+// MaskPII mascara CPFs (***.***.***-12) e telefones (55*******4321) no texto
+func MaskPII(text string) string {
+	text = cpfPattern.ReplaceAllStringFunc(text, func(cpf string) string {
+		return "***.***.***-" + cpf[len(cpf)-2:]
+	})
+	return phonePattern.ReplaceAllStringFunc(text, MaskPhone)
+}
+
+// MaskPhone mantém o código do país e os 4 últimos dígitos
+func MaskPhone(phone string) string {
+	digits := strings.TrimPrefix(phone, "+")
+	if len(digits) < 8 {
+		return strings.Repeat("*", len(digits))
+	}
+	return digits[:2] + strings.Repeat("*", len(digits)-6) + digits[len(digits)-4:]
+}
+
+// maskingHandler aplica MaskPII na mensagem e nos atributos de texto
+type maskingHandler struct {
+	next slog.Handler
+}
+
+func (h *maskingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *maskingHandler) Handle(ctx context.Context, record slog.Record) error {
+	masked := slog.NewRecord(record.Time, record.Level, MaskPII(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		masked.AddAttrs(maskAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, masked)
+}
+
+func (h *maskingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		masked[i] = maskAttr(attr)
 	}
-	InfoLogger = log.New(io.MultiWriter(file, os.Stderr), "INFO: ", log.Ldate|log.Ltime)
-	WarningLogger = log.New(io.MultiWriter(file, os.Stderr), "WARNING: ", log.Ldate|log.Ltime)
-	ErrorLogger = log.New(io.MultiWriter(file, os.Stderr), "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	return &maskingHandler{next: h.next.WithAttrs(masked)}
 }
 
-func (log Logger) Info(v any) {
-	InfoLogger.Println(v)
+func (h *maskingHandler) WithGroup(name string) slog.Handler {
+	return &maskingHandler{next: h.next.WithGroup(name)}
 }
 
-func (log Logger) Warn(v any) {
-	WarningLogger.Println(v)
+func maskAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, MaskPII(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		masked := make([]any, len(group))
+		for i, item := range group {
+			masked[i] = maskAttr(item)
+		}
+		return slog.Group(attr.Key, masked...)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, MaskPII(err.Error()))
+		}
+		if stringer, ok := value.Any().(fmt.Stringer); ok {
+			return slog.String(attr.Key, MaskPII(stringer.String()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// WALogger encaminha os logs do whatsmeow para o logger do bot, a partir de
+// LOG_WA_LEVEL
+func WALogger(module string) waLog.Logger {
+	return waLogger{module: module}
+}
+
+type waLogger struct {
+	module string
+}
+
+func (l waLogger) log(level slog.Level, msg string, args []interface{}) {
+	if level < slog.Level(waLevel.Load()) {
+		return
+	}
+	Log().Log(context.Background(), level, fmt.Sprintf(msg, args...), "module", l.module)
+}
+
+func (l waLogger) Debugf(msg string, args ...interface{}) { l.log(slog.LevelDebug, msg, args) }
+func (l waLogger) Infof(msg string, args ...interface{})  { l.log(slog.LevelInfo, msg, args) }
+func (l waLogger) Warnf(msg string, args ...interface{})  { l.log(slog.LevelWarn, msg, args) }
+func (l waLogger) Errorf(msg string, args ...interface{}) { l.log(slog.LevelError, msg, args) }
+
+func (l waLogger) Sub(module string) waLog.Logger {
+	return waLogger{module: l.module + "/" + module}
 }
 
-func (log Logger) Error(v any) {
-	ErrorLogger.Println(v)
+// Logger retorna o logger do bot com o componente informado (ex: "fila")
+func Logger(component string) *slog.Logger {
+	return Log().With("component", component)
 }
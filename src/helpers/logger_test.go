@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestMaskPII(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"CPF formatado", "cpf 529.982.247-25 recusado", "cpf ***.***.***-25 recusado"},
+		{"CPF sem formatação", "cpf 52998224725 recusado", "cpf 52*****4725 recusado"},
+		{"telefone com DDI", "ligação de 5511999990000", "ligação de 55*******0000"},
+		{"telefone com +", "ligação de +5511999990000", "ligação de 55*******0000"},
+		{"JID", "5511999990000@s.whatsapp.net", "55*******0000@s.whatsapp.net"},
+		{"JID com dispositivo", "5511999990000:12@s.whatsapp.net", "55*******0000:12@s.whatsapp.net"},
+		{"vários dados", "529.982.247-25 / 5511999990000", "***.***.***-25 / 55*******0000"},
+		{"números curtos", "opção 4, parcela 12 de 2024", "opção 4, parcela 12 de 2024"},
+		{"sem dados pessoais", "Menu enviado", "Menu enviado"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaskPII(tt.text); got != tt.want {
+				t.Errorf("MaskPII(%q) = %q, esperado %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskingHandler(t *testing.T) {
+	jid := types.NewJID("5511999990000", types.DefaultUserServer)
+	tests := []struct {
+		name string
+		log  func(logger *slog.Logger)
+		want []string
+	}{
+		{
+			name: "mensagem",
+			log:  func(logger *slog.Logger) { logger.Info("Recebido de 5511999990000") },
+			want: []string{"Recebido de 55*******0000"},
+		},
+		{
+			name: "atributo de texto",
+			log:  func(logger *slog.Logger) { logger.Info("Verificação", "cpf", "529.982.247-25") },
+			want: []string{"cpf=***.***.***-25"},
+		},
+		{
+			name: "erro",
+			log: func(logger *slog.Logger) {
+				logger.Error("Falha", "error", errors.New("destinatário 5511999990000 inválido"))
+			},
+			want: []string{`error="destinatário 55*******0000 inválido"`},
+		},
+		{
+			name: "JID (Stringer)",
+			log:  func(logger *slog.Logger) { logger.Info("Chat", "chat", jid) },
+			want: []string{"chat=55*******0000@s.whatsapp.net"},
+		},
+		{
+			name: "grupos aninhados",
+			log: func(logger *slog.Logger) {
+				logger.Info("Cadastro", slog.Group("membro",
+					slog.String("telefone", "5511999990000"),
+					slog.Group("documento", slog.String("cpf", "52998224725")),
+				))
+			},
+			want: []string{"membro.telefone=55*******0000", "membro.documento.cpf=52*****4725"},
+		},
+		{
+			name: "atributos do logger",
+			log: func(logger *slog.Logger) {
+				logger.With("user", "5511999990000").Info("Stage alterado")
+			},
+			want: []string{"user=55*******0000"},
+		},
+		{
+			name: "grupo do logger",
+			log: func(logger *slog.Logger) {
+				logger.WithGroup("sessao").With("owner", "5511988887777").Info("Alerta", "detail", "cpf 529.982.247-25")
+			},
+			want: []string{"sessao.owner=55*******7777", `sessao.detail="cpf ***.***.***-25"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(slog.New(&maskingHandler{next: slog.NewTextHandler(&buf, nil)}))
+
+			out := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("log sem %q:\n%s", want, out)
+				}
+			}
+			for _, raw := range []string{"5511999990000", "5511988887777", "52998224725", "529.982.247-25"} {
+				if strings.Contains(out, raw) {
+					t.Errorf("log com o dado original %q:\n%s", raw, out)
+				}
+			}
+		})
+	}
+}
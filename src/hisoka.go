@@ -3,13 +3,16 @@ package conn
 import (
 	"context"
 	"fmt"
+	"hisoka/src/config"
 	"hisoka/src/handlers"
 	"hisoka/src/helpers"
 	"hisoka/src/libs"
 	"os"
 	"os/signal"
-	"regexp"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	_ "hisoka/src/stages"
 
@@ -20,7 +23,6 @@ import (
 	"go.mau.fi/whatsmeow/store"
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
-	waLog "go.mau.fi/whatsmeow/util/log"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -29,89 +31,186 @@ type Template struct {
 	Status bool
 }
 
-var log helpers.Logger
-
 func init() {
 	store.DeviceProps.PlatformType = waCompanionReg.DeviceProps_EDGE.Enum()
 	store.DeviceProps.Os = proto.String("Linux")
 }
 
-func StartClient() {
-	ctx := context.Background()
-	dbLog := waLog.Stdout("Database", "ERROR", true)
+func StartClient(cfg *config.Config) {
+	log := helpers.Log()
+	for _, warning := range cfg.Warnings {
+		log.Warn("Configuração", "warning", warning)
+	}
 	
-	// Obter diretório de sessão das variáveis de ambiente
-	sessionDir := os.Getenv("SESSION_DIR")
-	if sessionDir == "" {
-		sessionDir = "."
+	container, err := openSessionStore(cfg)
+	if err != nil {
+		panic(err)
 	}
-	sessionPath := sessionDir + "/session.db"
 	
-	container, err := sqlstore.New(ctx, "sqlite3", "file:"+sessionPath+"?_foreign_keys=on", dbLog)
+	// Carrega as linhas de atendimento (números de WhatsApp)
+	sessions, err := libs.LoadSessions(cfg)
 	if err != nil {
 		panic(err)
 	}
 	
 	// Inicializa o sistema de stages
-	err = libs.InitStages()
+	err = libs.InitStages(cfg)
+	if err != nil {
+		panic(err)
+	}
+	log.Info("Sistema de stages inicializado", "stages", len(libs.GetAllStages()))
+	
+	// Carrega o catálogo de textos e verifica os templates usados pelos stages
+	err = libs.LoadTemplates(cfg)
+	if err != nil {
+		panic(err)
+	}
+	err = libs.ValidateTemplates()
+	if err != nil {
+		panic(err)
+	}
+	log.Info("Templates carregados", "locales", strings.Join(libs.Locales(), ", "))
+	
+	// Transcrição das mensagens de voz (opcional)
+	transcriber, err := libs.NewTranscriberFromConfig(cfg.Transcriber)
+	if err != nil {
+		panic(err)
+	}
+	if transcriber != nil {
+		libs.SetTranscriber(transcriber)
+		log.Info("Transcrição de voz ativada", "transcriber", cfg.Transcriber.Kind)
+	}
+	
+	var conns []*whatsmeow.Client
+	for _, session := range sessions {
+		conns = append(conns, startSession(container, session, cfg))
+	}
+	
+	// API administrativa (opcional): recarga dos textos
+	err = libs.StartAdminServer(cfg)
 	if err != nil {
 		panic(err)
 	}
-	log.Info("Stages system initialized")
 	
-	handler := handlers.NewHandler(container)
-	log.Info("Connecting Socket")
+	// SIGHUP recarrega os textos sem reconectar as sessões
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Info("SIGHUP recebido, recarregando templates")
+			if _, err := libs.Reload(cfg); err != nil {
+				log.Error("Recarga falhou, mantendo a versão atual", "error", err)
+			}
+		}
+	}()
+
+	// Listen to Ctrl+C (you can also do something else that prevents the program from exiting)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	sig := <-c
+	log.Info("Sinal recebido, iniciando desligamento", "signal", sig.String())
+
+	shutdown(conns, container, cfg.ShutdownTimeout)
+}
+
+// Conecta o número de uma sessão, pareando por código ou QR quando necessário
+func startSession(container *sqlstore.Container, session *libs.Session, cfg *config.Config) *whatsmeow.Client {
+	log := helpers.Log().With("session", session.ID)
+	handler := handlers.NewHandler(container, session, cfg)
+	log.Info("Conectando socket")
 	conn := handler.Client()
 	conn.PrePairCallback = func(jid types.JID, platform, businessName string) bool {
-		log.Info("Connected Socket")
+		log.Info("Socket conectado")
 		return true
 	}
 
 	if conn.Store.ID == nil {
 		// No ID stored, new login
-		pairingNumber := os.Getenv("PAIRING_NUMBER")
-
-		if pairingNumber != "" {
-			pairingNumber = regexp.MustCompile(`\D+`).ReplaceAllString(pairingNumber, "")
-
-			if err := conn.Connect(); err != nil {
-				panic(err)
-			}
-
-			ctx := context.Background()
-			code, err := conn.PairPhone(ctx, pairingNumber, true, whatsmeow.PairClientChrome, "Edge (Linux)")
-			if err != nil {
-				panic(err)
-			}
-
-			fmt.Println("Code Kamu : " + code)
-		} else {
-			qrChan, _ := conn.GetQRChannel(context.Background())
-			if err := conn.Connect(); err != nil {
-				panic(err)
-			}
-
-			for evt := range qrChan {
-				switch string(evt.Event) {
-				case "code":
-					qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
-					log.Info("Qr Required")
-				}
-			}
+		if err := pairDevice(conn, session.ID, session.PairingNumber); err != nil {
+			panic(err)
 		}
 	} else {
 		// Already logged in, just connect
 		if err := conn.Connect(); err != nil {
 			panic(err)
 		}
-		log.Info("Connected Socket")
+		log.Info("Socket conectado")
 	}
+	return conn
+}
 
-	// Listen to Ctrl+C (you can also do something else that prevents the program from exiting)
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+// Abre o session.db do whatsmeow em SESSION_DIR
+func openSessionStore(cfg *config.Config) (*sqlstore.Container, error) {
+	if err := os.MkdirAll(cfg.SessionDir, 0755); err != nil {
+		return nil, err
+	}
+	sessionPath := filepath.Join(cfg.SessionDir, "session.db")
+	return sqlstore.New(context.Background(), "sqlite3", "file:"+sessionPath+"?_foreign_keys=on", helpers.WALogger("Database"))
+}
+
+// Conecta um dispositivo ainda não pareado: com phone, mostra o código de
+// pareamento; sem, mostra o QR code no terminal até ser lido ou expirar
+func pairDevice(conn *whatsmeow.Client, sessionID string, phone string) error {
+	log := helpers.Log().With("session", sessionID)
+	if phone != "" {
+		if err := conn.Connect(); err != nil {
+			return err
+		}
+
+		code, err := conn.PairPhone(context.Background(), phone, true, whatsmeow.PairClientChrome, "Edge (Linux)")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("[" + sessionID + "] Code Kamu : " + code)
+		return nil
+	}
 
-	conn.Disconnect()
-	libs.CloseStagesDB()
+	qrChan, _ := conn.GetQRChannel(context.Background())
+	if err := conn.Connect(); err != nil {
+		return err
+	}
+
+	for evt := range qrChan {
+		switch string(evt.Event) {
+		case "code":
+			qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
+			log.Info("QR code necessário para parear")
+		}
+	}
+	return nil
+}
+
+// shutdown encerra o bot de forma coordenada: para de aceitar eventos, aguarda
+// os handlers em andamento (com prazo), executa os hooks de desligamento e só
+// então desconecta o socket e fecha os bancos de dados.
+func shutdown(conns []*whatsmeow.Client, container *sqlstore.Container, timeout time.Duration) {
+	log := helpers.Log()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	abandoned := libs.Drain(ctx)
+	for _, work := range abandoned {
+		log.Warn("Trabalho abandonado no desligamento", "work", work)
+	}
+	if len(abandoned) == 0 {
+		log.Info("Nenhum trabalho pendente, prosseguindo com o desligamento")
+	}
+
+	for _, err := range libs.RunShutdownHooks(ctx) {
+		log.Error("Erro no desligamento", "error", err)
+	}
+
+	for _, conn := range conns {
+		conn.Disconnect()
+	}
+
+	if err := libs.CloseStagesDB(); err != nil {
+		log.Error("Erro ao fechar stages.db", "error", err)
+	}
+	if err := container.Close(); err != nil {
+		log.Error("Erro ao fechar session.db", "error", err)
+	}
+	log.Info("Desligamento concluído")
 }
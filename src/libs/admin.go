@@ -0,0 +1,82 @@
+package libs
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StartAdminServer inicia a API administrativa em ADMIN_ADDR (ex:
+// 127.0.0.1:8081), se configurado. As requisições precisam do cabeçalho
+// "Authorization: Bearer <ADMIN_TOKEN>".
+//
+//	POST /reload  recarrega os templates (ver Reload)
+func StartAdminServer(cfg *config.Config) error {
+	addr := cfg.AdminAddr
+	if addr == "" {
+		return nil
+	}
+	token := cfg.AdminToken
+	if token == "" {
+		return fmt.Errorf("ADMIN_ADDR configurado sem ADMIN_TOKEN")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reload", adminAuth(token, reloadHandler(cfg)))
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			helpers.Logger("admin").Error("Erro na API administrativa", "error", err)
+		}
+	}()
+	RegisterShutdownHook("api administrativa", func(ctx context.Context) error {
+		return server.Shutdown(ctx)
+	})
+	helpers.Logger("admin").Info("API administrativa iniciada", "addr", addr)
+	return nil
+}
+
+func adminAuth(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "não autorizado"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func reloadHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+			return
+		}
+
+		result, err := Reload(cfg)
+		if err != nil {
+			helpers.Logger("reload").Error("Recarga recusada", "error", err)
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"locales":     result.Locales,
+			"duration_ms": result.Duration.Milliseconds(),
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
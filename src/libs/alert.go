@@ -0,0 +1,57 @@
+package libs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hisoka/src/helpers"
+	"net/http"
+	"time"
+)
+
+// Alerta enviado aos owners por um canal fora do WhatsApp
+type Alert struct {
+	Session   string   `json:"session"`
+	Subject   string   `json:"subject"`
+	Detail    string   `json:"detail"`
+	Owners    []string `json:"owners"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// NotifyOwners avisa os owners quando o WhatsApp não pode ser usado (sessão
+// perdida, banimento...). O alerta é enviado via POST JSON para ALERT_WEBHOOK_URL;
+// sem webhook configurado ele fica apenas no log.
+func NotifyOwners(session *Session, subject string, detail string) error {
+	alert := Alert{
+		Session:   session.ID,
+		Subject:   subject,
+		Detail:    detail,
+		Owners:    session.Owners,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	helpers.Logger("alerta").Warn(subject, "session", session.ID, "detail", detail)
+
+	webhook := session.Config.AlertWebhookURL
+	if webhook == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	resp, err := alertClient.Post(webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook de alerta respondeu %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package libs
+
+import (
+	"hisoka/src/helpers"
+	"strings"
+)
+
+// Tamanho máximo do resumo do chamado (o texto completo fica em Data)
+const handoffSummaryLength = 200
+
+// Palavras que pedem atendimento humano em qualquer stage
+var handoffCommands = map[string]bool{
+	"atendente": true,
+	"agente":    true,
+	"agent":     true,
+	"humano":    true,
+	"human":     true,
+}
+
+// Registra o stage de atendimento humano ("Não encontrou?" no menu)
+func registerAtendimentoStage() {
+	RegisterStage(&Stage{
+		ID:          "duvidas",
+		Name:        "Atendimento",
+		Description: "Encaminha a dúvida do membro para um atendente",
+		Handler:     duvidasHandler,
+		Templates:   []string{"atendimento", "atendimento_aberto", "erro_voltar", "erro_sistema"},
+		NextStages:  []string{"default"},
+		IsOwner:     false,
+		IsGroup:     false,
+		IsPrivate:   false,
+	})
+}
+
+// Leva o membro ao atendimento humano a partir de qualquer stage (ex: pela
+// resposta às chamadas recusadas)
+func handleHandoffCommand(conn *IClient, m *IMessage) bool {
+	if !handoffCommands[strings.ToLower(strings.TrimSpace(m.Text))] {
+		return false
+	}
+	if err := startHandoff(conn, m, ""); err != nil {
+		m.Log.Error("Erro ao iniciar atendimento", "component", "atendimento", "error", err)
+		m.Reply(conn.Render(m, "erro_sistema", nil))
+	}
+	return true
+}
+
+// Muda o membro para o atendimento humano e pede a descrição da dúvida. topic
+// é o assunto escolhido no menu ("" = não informado), registrado no chamado.
+func startHandoff(conn *IClient, m *IMessage, topic string) error {
+	userID := m.Sender.ToNonAD().User
+	if err := ChangeUserStage(conn.Session.ID, userID, "duvidas"); err != nil {
+		return err
+	}
+	userStage, err := GetUserStage(conn.Session.ID, userID)
+	if err != nil {
+		return err
+	}
+	conn.Typing = conn.stageTyping(GetStage("duvidas"))
+	askHandoffDescription(conn, m, userStage, topic)
+	return nil
+}
+
+// Pede a descrição da dúvida, guardando o assunto para o chamado
+func askHandoffDescription(conn *IClient, m *IMessage, userStage *UserStage, topic string) {
+	userStage.Data = map[string]interface{}{"step": "descricao"}
+	if topic != "" {
+		userStage.Data["assunto"] = topic
+	}
+	if err := SaveUserStage(userStage); err != nil {
+		helpers.Logger("atendimento").Error("Erro ao salvar etapa", "session", userStage.SessionID, "user", userStage.UserID, "error", err)
+	}
+	m.Reply(conn.Render(m, "atendimento", nil))
+}
+
+// Handler do atendimento humano. Etapas (userStage.Data["step"]): pede a
+// descrição da dúvida e, com ela, abre um chamado para a equipe (com o assunto
+// do menu em userStage.Data["assunto"], se houver) e volta o membro ao menu
+// principal.
+func duvidasHandler(conn *IClient, m *IMessage, userStage *UserStage) bool {
+	userID := m.Sender.ToNonAD().User
+	text := strings.TrimSpace(m.Text)
+	step, _ := userStage.Data["step"].(string)
+
+	log := m.Log.With("component", "atendimento")
+
+	switch strings.ToLower(text) {
+	case "0", "voltar", "menu", "início", "inicio":
+		err := ChangeUserStage(conn.Session.ID, userID, conn.Session.RootStage)
+		if err != nil {
+			m.Reply(conn.Render(m, "erro_voltar", map[string]interface{}{"Erro": err.Error()}))
+			return false
+		}
+		if rootStage := GetStage(conn.Session.RootStage); rootStage != nil && rootStage.Handler != nil {
+			userStage, _ := GetUserStage(conn.Session.ID, userID)
+			rootStage.Handler(conn, m, userStage)
+		}
+		return true
+	}
+
+	topic, _ := userStage.Data["assunto"].(string)
+	if step != "descricao" || text == "" {
+		askHandoffDescription(conn, m, userStage, topic)
+		return true
+	}
+
+	summary := []rune(text)
+	if len(summary) > handoffSummaryLength {
+		summary = append(summary[:handoffSummaryLength-1], '…')
+	}
+	ticket := &Ticket{
+		SessionID: userStage.SessionID,
+		UserID:    userStage.UserID,
+		Kind:      "atendimento",
+		Summary:   string(summary),
+		Data: map[string]interface{}{
+			"mensagem":  text,
+			"nome":      m.Info.PushName,
+			"protocolo": Protocol(m),
+		},
+	}
+	if topic != "" {
+		ticket.Data["assunto"] = topic
+	}
+	if err := CreateTicket(ticket); err != nil {
+		log.Error("Erro ao abrir chamado", "error", err)
+		m.Reply(conn.Render(m, "erro_sistema", nil))
+		return false
+	}
+	log.Info("Atendimento humano solicitado", "ticket", ticket.ID)
+
+	if err := ChangeUserStage(conn.Session.ID, userID, conn.Session.RootStage); err != nil {
+		log.Error("Erro ao voltar ao menu", "error", err)
+	}
+	m.Reply(conn.Render(m, "atendimento_aberto", map[string]interface{}{"Chamado": ticket.ID}))
+	return true
+}
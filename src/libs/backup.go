@@ -0,0 +1,38 @@
+package libs
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// BackupStagesDB grava uma cópia consistente do stages.db em dest, mesmo com
+// o bot em execução (VACUUM INTO)
+func BackupStagesDB(dest string) error {
+	if db == nil {
+		return fmt.Errorf("stages.db não inicializado")
+	}
+	return vacuumInto(db, dest)
+}
+
+// BackupSQLiteFile copia o banco SQLite em path (ex: session.db) para dest
+func BackupSQLiteFile(path string, dest string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return vacuumInto(conn, dest)
+}
+
+// VACUUM INTO falha se o destino já existir
+func vacuumInto(conn *sql.DB, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("'%s' já existe", dest)
+	}
+	_, err := conn.Exec("VACUUM INTO ?", dest)
+	return err
+}
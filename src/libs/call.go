@@ -0,0 +1,141 @@
+package libs
+
+import (
+	"context"
+	"database/sql"
+	"hisoka/src/helpers"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Chamadas mais antigas que isso (recebidas durante a sincronização offline)
+// já terminaram: são apenas registradas
+const staleCallAge = 2 * time.Minute
+
+// Serializa as chamadas para que toques repetidos não passem juntos pelo
+// limite de respostas
+var callMu sync.Mutex
+
+// Tentativa de chamada recebida pelo bot
+type CallAttempt struct {
+	ID        int64
+	SessionID string
+	Caller    string
+	CallID    string
+	Rejected  bool
+	Replied   bool
+	CreatedAt int64
+}
+
+// HandleCallOffer recusa a chamada recebida e explica ao membro que o canal
+// não atende ligações, oferecendo o menu ou o atendimento humano. A resposta
+// é enviada no máximo uma vez por CALL_REPLY_INTERVAL (padrão 10m) para o
+// mesmo número; todas as tentativas são registradas em call_attempts.
+func HandleCallOffer(conn *IClient, call types.BasicCallMeta) {
+	caller := call.From.ToNonAD()
+	if caller.Server == types.HiddenUserServer && conn.WA != nil {
+		// Chamadas de contas com LID: obtém o número para as regras de acesso
+		if pn, err := conn.WA.Store.LIDs.GetPNForLID(context.Background(), caller); err == nil && !pn.IsEmpty() {
+			caller = pn
+		}
+	}
+	userID := caller.User
+	log := helpers.Logger("call").With("session", conn.Session.ID, "user", userID, "call_id", call.CallID)
+
+	callMu.Lock()
+	defer callMu.Unlock()
+
+	attempt := &CallAttempt{
+		SessionID: conn.Session.ID,
+		Caller:    userID,
+		CallID:    call.CallID,
+		CreatedAt: time.Now().Unix(),
+	}
+	defer func() {
+		if err := RecordCallAttempt(attempt); err != nil {
+			log.Error("Erro ao registrar chamada", "error", err)
+		}
+	}()
+
+	if time.Since(call.Timestamp) > staleCallAge {
+		log.Info("Chamada antiga, apenas registrada", "called_at", call.Timestamp.Format(time.RFC3339))
+		return
+	}
+
+	if err := conn.Transport.RejectCall(call.From, call.CallID); err != nil {
+		log.Error("Erro ao recusar chamada", "error", err)
+	} else {
+		attempt.Rejected = true
+		log.Info("Chamada recusada")
+	}
+
+	if !conn.Session.IsAuthorized(userID) {
+		return
+	}
+
+	last, err := lastCallReply(conn.Session.ID, userID)
+	if err != nil {
+		log.Error("Erro ao consultar chamadas anteriores", "error", err)
+		return
+	}
+	interval := conn.Config.CallReplyInterval
+	if !last.IsZero() && time.Since(last) < interval {
+		log.Info("Membro já avisado, sem nova resposta", "replied_at", last.Format(time.RFC3339))
+		return
+	}
+
+	if _, err := conn.SendText(call.From.ToNonAD(), conn.RenderTo(userID, "chamada_recusada", nil), nil); err != nil {
+		log.Error("Erro ao responder chamada", "error", err)
+		return
+	}
+	attempt.Replied = true
+}
+
+// Registra uma tentativa de chamada
+func RecordCallAttempt(attempt *CallAttempt) error {
+	result, err := db.Exec(
+		"INSERT INTO call_attempts (session_id, caller, call_id, rejected, replied, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		attempt.SessionID, attempt.Caller, attempt.CallID, attempt.Rejected, attempt.Replied, attempt.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	attempt.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// Obtém as tentativas de chamada mais recentes (diagnóstico)
+func GetCallAttempts(limit int) ([]CallAttempt, error) {
+	rows, err := db.Query(
+		"SELECT id, session_id, caller, call_id, rejected, replied, created_at FROM call_attempts ORDER BY id DESC LIMIT ?", limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []CallAttempt
+	for rows.Next() {
+		var attempt CallAttempt
+		if err := rows.Scan(&attempt.ID, &attempt.SessionID, &attempt.Caller, &attempt.CallID, &attempt.Rejected, &attempt.Replied, &attempt.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+// Momento da última resposta enviada ao número (zero se nunca respondido)
+func lastCallReply(sessionID string, caller string) (time.Time, error) {
+	var last sql.NullInt64
+	err := db.QueryRow(
+		"SELECT MAX(created_at) FROM call_attempts WHERE session_id = ? AND caller = ? AND replied = 1",
+		sessionID, caller,
+	).Scan(&last)
+	if err != nil || !last.Valid {
+		return time.Time{}, err
+	}
+	return time.Unix(last.Int64, 0), nil
+}
@@ -2,7 +2,7 @@ package libs
 
 import (
 	"context"
-	"fmt"
+	"hisoka/src/helpers"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -14,19 +14,44 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-func SerializeClient(conn *whatsmeow.Client) *IClient {
+func SerializeClient(conn *whatsmeow.Client, session *Session) *IClient {
 	return &IClient{
-		WA: conn,
+		WA:        conn,
+		Transport: conn,
+		Session:   session,
+		Config:    session.Config,
 	}
 }
 
+// Informa se os envios passam pela fila da sessão. Nesse caso a resposta de
+// um envio confirma apenas que a mensagem foi enfileirada.
+func (conn *IClient) queued() bool {
+	return conn.WA != nil && getSendQueue(conn.Session) != nil
+}
+
+// Envia a mensagem pela fila da sessão quando ela está ativa, ou diretamente
+// caso contrário. O fallback é usado se a mensagem falhar de forma permanente.
+func (conn *IClient) send(to types.JID, message *waE2E.Message, fallback *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	typing := conn.typingDelay(message)
+	if conn.queued() {
+		return getSendQueue(conn.Session).Enqueue(to, message, fallback, typing, extra...)
+	}
+
+	conn.simulateTyping(context.Background(), to, typing)
+	resp, err := conn.Transport.SendMessage(context.Background(), to, message, extra...)
+	if err != nil && fallback != nil {
+		return conn.Transport.SendMessage(context.Background(), to, fallback, extra...)
+	}
+	return resp, err
+}
+
 func (conn *IClient) SendText(from types.JID, txt string, opts *waE2E.ContextInfo, optn ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
-	ok, er := conn.WA.SendMessage(context.Background(), from, &waE2E.Message{
+	ok, er := conn.send(from, &waE2E.Message{
 		ExtendedTextMessage: &waE2E.ExtendedTextMessage{
 			Text:        proto.String(txt),
 			ContextInfo: opts,
 		},
-	}, optn...)
+	}, nil, optn...)
 	if er != nil {
 		return whatsmeow.SendResponse{}, er
 	}
@@ -55,9 +80,10 @@ func (conn *IClient) SendWithNewsLestter(from types.JID, text string, newjid str
 }
 
 func (conn *IClient) SendImage(from types.JID, data []byte, caption string, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error) {
-	uploaded, err := conn.WA.Upload(context.Background(), data, whatsmeow.MediaImage)
+	media := PrepareMedia(conn.Config, data, "")
+	uploaded, err := conn.Transport.Upload(context.Background(), data, whatsmeow.MediaImage)
 	if err != nil {
-		fmt.Printf("Failed to upload file: %v\n", err)
+		helpers.Logger("client").Error("Falha ao enviar arquivo", "error", err)
 		return whatsmeow.SendResponse{}, err
 	}
 	resultImg := &waE2E.Message{
@@ -66,21 +92,28 @@ func (conn *IClient) SendImage(from types.JID, data []byte, caption string, opts
 			DirectPath:    proto.String(uploaded.DirectPath),
 			MediaKey:      uploaded.MediaKey,
 			Caption:       proto.String(caption),
-			Mimetype:      proto.String(http.DetectContentType(data)),
+			Mimetype:      proto.String(media.MimeType),
 			FileEncSHA256: uploaded.FileEncSHA256,
 			FileSHA256:    uploaded.FileSHA256,
 			FileLength:    proto.Uint64(uint64(len(data))),
+			JPEGThumbnail: media.Thumbnail,
+			Width:         optionalUint32(media.Width),
+			Height:        optionalUint32(media.Height),
 			ContextInfo:   opts,
 		},
 	}
-	ok, _ := conn.WA.SendMessage(context.Background(), from, resultImg)
+	ok, er := conn.send(from, resultImg, nil)
+	if er != nil {
+		return whatsmeow.SendResponse{}, er
+	}
 	return ok, nil
 }
 
 func (conn *IClient) SendVideo(from types.JID, data []byte, caption string, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error) {
-	uploaded, err := conn.WA.Upload(context.Background(), data, whatsmeow.MediaVideo)
+	media := PrepareMedia(conn.Config, data, "")
+	uploaded, err := conn.Transport.Upload(context.Background(), data, whatsmeow.MediaVideo)
 	if err != nil {
-		fmt.Printf("Failed to upload file: %v\n", err)
+		helpers.Logger("client").Error("Falha ao enviar arquivo", "error", err)
 		return whatsmeow.SendResponse{}, err
 	}
 	resultVideo := &waE2E.Message{
@@ -89,14 +122,18 @@ func (conn *IClient) SendVideo(from types.JID, data []byte, caption string, opts
 			DirectPath:    proto.String(uploaded.DirectPath),
 			MediaKey:      uploaded.MediaKey,
 			Caption:       proto.String(caption),
-			Mimetype:      proto.String(http.DetectContentType(data)),
+			Mimetype:      proto.String(media.MimeType),
 			FileEncSHA256: uploaded.FileEncSHA256,
 			FileSHA256:    uploaded.FileSHA256,
 			FileLength:    proto.Uint64(uint64(len(data))),
+			JPEGThumbnail: media.Thumbnail,
+			Seconds:       optionalUint32(media.Duration),
+			Width:         optionalUint32(media.Width),
+			Height:        optionalUint32(media.Height),
 			ContextInfo:   opts,
 		},
 	}
-	ok, er := conn.WA.SendMessage(context.Background(), from, resultVideo)
+	ok, er := conn.send(from, resultVideo, nil)
 	if er != nil {
 		return whatsmeow.SendResponse{}, er
 	}
@@ -104,9 +141,10 @@ func (conn *IClient) SendVideo(from types.JID, data []byte, caption string, opts
 }
 
 func (conn *IClient) SendDocument(from types.JID, data []byte, fileName string, caption string, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error) {
-	uploaded, err := conn.WA.Upload(context.Background(), data, whatsmeow.MediaDocument)
+	media := PrepareMedia(conn.Config, data, fileName)
+	uploaded, err := conn.Transport.Upload(context.Background(), data, whatsmeow.MediaDocument)
 	if err != nil {
-		fmt.Printf("Failed to upload file: %v\n", err)
+		helpers.Logger("client").Error("Falha ao enviar arquivo", "error", err)
 		return whatsmeow.SendResponse{}, err
 	}
 	resultDoc := &waE2E.Message{
@@ -116,14 +154,16 @@ func (conn *IClient) SendDocument(from types.JID, data []byte, fileName string,
 			MediaKey:      uploaded.MediaKey,
 			FileName:      proto.String(fileName),
 			Caption:       proto.String(caption),
-			Mimetype:      proto.String(http.DetectContentType(data)),
+			Mimetype:      proto.String(media.MimeType),
 			FileEncSHA256: uploaded.FileEncSHA256,
 			FileSHA256:    uploaded.FileSHA256,
 			FileLength:    proto.Uint64(uint64(len(data))),
+			JPEGThumbnail: media.Thumbnail,
+			PageCount:     optionalUint32(media.PageCount),
 			ContextInfo:   opts,
 		},
 	}
-	ok, er := conn.WA.SendMessage(context.Background(), from, resultDoc)
+	ok, er := conn.send(from, resultDoc, nil)
 	if er != nil {
 		return whatsmeow.SendResponse{}, er
 	}
@@ -131,7 +171,7 @@ func (conn *IClient) SendDocument(from types.JID, data []byte, fileName string,
 }
 
 func (conn *IClient) DeleteMsg(from types.JID, id string, me bool) {
-	conn.WA.SendMessage(context.Background(), from, &waE2E.Message{
+	conn.send(from, &waE2E.Message{
 		ProtocolMessage: &waE2E.ProtocolMessage{
 			Type: waE2E.ProtocolMessage_REVOKE.Enum(),
 			Key: &waCommon.MessageKey{
@@ -139,7 +179,7 @@ func (conn *IClient) DeleteMsg(from types.JID, id string, me bool) {
 				ID:     proto.String(id),
 			},
 		},
-	})
+	}, nil)
 }
 
 func (conn *IClient) ParseJID(arg string) (types.JID, bool) {
@@ -161,7 +201,7 @@ func (conn *IClient) ParseJID(arg string) (types.JID, bool) {
 
 func (conn *IClient) FetchGroupAdmin(Jid types.JID) ([]string, error) {
 	var Admin []string
-	resp, err := conn.WA.GetGroupInfo(Jid)
+	resp, err := conn.Transport.GetGroupInfo(Jid)
 	if err != nil {
 		return Admin, err
 	} else {
@@ -175,24 +215,32 @@ func (conn *IClient) FetchGroupAdmin(Jid types.JID) ([]string, error) {
 }
 
 func (conn *IClient) SendSticker(jid types.JID, data []byte, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error) {
-	uploaded, err := conn.WA.Upload(context.Background(), data, whatsmeow.MediaImage)
+	// Figurinhas precisam ser WebP 512x512
+	data, err := ToWebPSticker(conn.Config, data)
+	if err != nil {
+		helpers.Logger("client").Error("Falha ao converter figurinha", "error", err)
+		return whatsmeow.SendResponse{}, err
+	}
+	uploaded, err := conn.Transport.Upload(context.Background(), data, whatsmeow.MediaImage)
 	if err != nil {
-		fmt.Printf("Failed to upload file: %v\n", err)
+		helpers.Logger("client").Error("Falha ao enviar arquivo", "error", err)
 		return whatsmeow.SendResponse{}, err
 	}
 
-	ok, er := conn.WA.SendMessage(context.Background(), jid, &waE2E.Message{
+	ok, er := conn.send(jid, &waE2E.Message{
 		StickerMessage: &waE2E.StickerMessage{
 			URL:           proto.String(uploaded.URL),
 			DirectPath:    proto.String(uploaded.DirectPath),
 			MediaKey:      uploaded.MediaKey,
-			Mimetype:      proto.String(http.DetectContentType(data)),
+			Mimetype:      proto.String("image/webp"),
 			FileEncSHA256: uploaded.FileEncSHA256,
 			FileSHA256:    uploaded.FileSHA256,
 			FileLength:    proto.Uint64(uint64(len(data))),
+			Width:         proto.Uint32(stickerSize),
+			Height:        proto.Uint32(stickerSize),
 			ContextInfo:   opts,
 		},
-	})
+	}, nil)
 
 	if er != nil {
 		return whatsmeow.SendResponse{}, er
@@ -214,3 +262,11 @@ func (conn *IClient) GetBytes(url string) ([]byte, error) {
 
 	return bytes, nil
 }
+
+// Campos opcionais das mensagens de mídia: nil quando o valor não é conhecido
+func optionalUint32(value uint32) *uint32 {
+	if value == 0 {
+		return nil
+	}
+	return proto.Uint32(value)
+}
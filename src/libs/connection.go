@@ -0,0 +1,77 @@
+package libs
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Eventos de conexão registrados no histórico
+const (
+	ConnEventConnected      = "connected"
+	ConnEventDisconnected   = "disconnected"
+	ConnEventReconnecting   = "reconnecting"
+	ConnEventLoggedOut      = "logged_out"
+	ConnEventStreamReplaced = "stream_replaced"
+	ConnEventTemporaryBan   = "temporary_ban"
+	ConnEventConnectFailure = "connect_failure"
+	ConnEventKeepAlive      = "keepalive_timeout"
+	ConnEventClientOutdated = "client_outdated"
+)
+
+type ConnectionEvent struct {
+	ID        int64
+	SessionID string
+	Event     string
+	Detail    string
+	CreatedAt int64
+}
+
+// Registra um evento de conexão no histórico para diagnóstico
+func RecordConnectionEvent(sessionID string, event string, detail string) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.Exec(
+		"INSERT INTO connection_events (session_id, event, detail, created_at) VALUES (?, ?, ?, ?)",
+		sessionID, event, detail, time.Now().Unix(),
+	)
+	return err
+}
+
+// Obtém os últimos eventos de conexão, do mais recente para o mais antigo
+func GetConnectionHistory(limit int) ([]ConnectionEvent, error) {
+	rows, err := db.Query(
+		"SELECT id, session_id, event, detail, created_at FROM connection_events ORDER BY id DESC LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []ConnectionEvent
+	for rows.Next() {
+		var evt ConnectionEvent
+		if err := rows.Scan(&evt.ID, &evt.SessionID, &evt.Event, &evt.Detail, &evt.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, evt)
+	}
+	return history, rows.Err()
+}
+
+// Obtém o último evento de conexão da sessão (nil se não houver)
+func LastConnectionEvent(sessionID string) (*ConnectionEvent, error) {
+	var evt ConnectionEvent
+	err := db.QueryRow(
+		"SELECT id, session_id, event, detail, created_at FROM connection_events WHERE session_id = ? ORDER BY id DESC LIMIT 1",
+		sessionID,
+	).Scan(&evt.ID, &evt.SessionID, &evt.Event, &evt.Detail, &evt.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &evt, nil
+}
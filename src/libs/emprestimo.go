@@ -0,0 +1,537 @@
+package libs
+
+import (
+	"errors"
+	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parcelas mostradas no resumo da simulação
+const loanPreviewInstallments = 3
+
+// IOF de operações de crédito de pessoa física: alíquota diária (limitada a
+// 365 dias) sobre o valor amortizado em cada parcela, mais a adicional sobre
+// o valor total
+const (
+	defaultIOFDaily      = 0.0082 // % ao dia
+	defaultIOFAdditional = 0.38   // %
+	iofMaxDays           = 365
+)
+
+// Linha de crédito oferecida na simulação de empréstimos
+type CreditLine struct {
+	ID              string  `yaml:"id"`
+	Name            string  `yaml:"nome"`
+	MonthlyRate     float64 `yaml:"taxa_mensal"`  // Juros, % ao mês
+	MaxInstallments int     `yaml:"parcelas_max"` // Prazo máximo, em meses
+	MinAmount       float64 `yaml:"valor_min"`
+	MaxAmount       float64 `yaml:"valor_max"`
+	Fee             float64 `yaml:"tarifa"`     // Tarifa de cadastro, descontada do valor liberado
+	IOFExempt       bool    `yaml:"isento_iof"` // Linha sem IOF
+}
+
+// Arquivo das linhas de crédito (CREDIT_LINES_FILE, padrão DATA_DIR/emprestimos.yaml)
+//
+//	iof:
+//	  diario: 0.0082      # % ao dia
+//	  adicional: 0.38     # %
+//	linhas:
+//	  - id: pessoal
+//	    nome: Empréstimo Pessoal
+//	    taxa_mensal: 1.99
+//	    parcelas_max: 36
+//	    valor_min: 500
+//	    valor_max: 30000
+type CreditLinesFile struct {
+	IOF struct {
+		Daily      *float64 `yaml:"diario"`
+		Additional *float64 `yaml:"adicional"`
+	} `yaml:"iof"`
+	Lines []*CreditLine `yaml:"linhas"`
+}
+
+func creditLinesPath(cfg *config.Config) string {
+	if cfg.CreditLines != "" {
+		return cfg.CreditLines
+	}
+	return filepath.Join(cfg.DataDir, "emprestimos.yaml")
+}
+
+// LoadCreditLines lê e valida o arquivo das linhas de crédito. O arquivo é
+// lido a cada consulta para refletir atualizações sem reiniciar.
+func LoadCreditLines(cfg *config.Config) (*CreditLinesFile, error) {
+	path := creditLinesPath(cfg)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file CreditLinesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := file.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &file, nil
+}
+
+func (f *CreditLinesFile) validate() error {
+	var errs []error
+	if len(f.Lines) == 0 {
+		errs = append(errs, fmt.Errorf("nenhuma linha de crédito em 'linhas'"))
+	}
+	seen := make(map[string]bool)
+	for i, line := range f.Lines {
+		name := line.ID
+		if name == "" {
+			name = fmt.Sprintf("linha %d", i+1)
+			errs = append(errs, fmt.Errorf("%s: id vazio", name))
+		} else if seen[line.ID] {
+			errs = append(errs, fmt.Errorf("%s: id repetido", name))
+		}
+		seen[line.ID] = true
+		if line.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: nome vazio", name))
+		}
+		if line.MonthlyRate < 0 {
+			errs = append(errs, fmt.Errorf("%s: taxa_mensal negativa", name))
+		}
+		if line.MaxInstallments < 1 {
+			errs = append(errs, fmt.Errorf("%s: parcelas_max deve ser ao menos 1", name))
+		}
+		if line.MinAmount < 0 || line.MaxAmount <= 0 || line.MinAmount > line.MaxAmount {
+			errs = append(errs, fmt.Errorf("%s: valor_min e valor_max inválidos", name))
+		}
+		if line.Fee < 0 {
+			errs = append(errs, fmt.Errorf("%s: tarifa negativa", name))
+		}
+	}
+	for _, rate := range []*float64{f.IOF.Daily, f.IOF.Additional} {
+		if rate != nil && *rate < 0 {
+			errs = append(errs, fmt.Errorf("iof: alíquota negativa"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Linha pelo número exibido no menu (1, 2...) ou pelo ID
+func (f *CreditLinesFile) Find(choice string) *CreditLine {
+	choice = strings.ToLower(strings.TrimSpace(choice))
+	if n, err := strconv.Atoi(choice); err == nil && n >= 1 && n <= len(f.Lines) {
+		return f.Lines[n-1]
+	}
+	for _, line := range f.Lines {
+		if line.ID == choice {
+			return line
+		}
+	}
+	return nil
+}
+
+// Parcela da tabela Price
+type LoanInstallment struct {
+	Number       int
+	Payment      float64
+	Interest     float64
+	Amortization float64
+	Balance      float64 // Saldo devedor após o pagamento
+}
+
+// Resultado de uma simulação pela tabela Price
+type LoanSimulation struct {
+	Line         *CreditLine
+	Amount       float64 // Valor solicitado
+	Installments int
+	Payment      float64 // Parcela fixa (PMT)
+	Total        float64 // Soma das parcelas
+	Interest     float64 // Juros totais
+	IOF          float64 // Aproximação, descontada do valor liberado
+	Released     float64 // Valor liberado: solicitado - IOF - tarifa
+	CETMonthly   float64 // Custo efetivo total estimado, % ao mês
+	CETYearly    float64 // % ao ano
+	Schedule     []LoanInstallment
+}
+
+// SimulateLoan calcula as parcelas pela tabela Price, o IOF aproximado e o
+// CET estimado (taxa que iguala o valor liberado às parcelas)
+func (f *CreditLinesFile) SimulateLoan(line *CreditLine, amount float64, installments int) (*LoanSimulation, error) {
+	if amount < line.MinAmount || amount > line.MaxAmount {
+		return nil, fmt.Errorf("valor fora dos limites da linha %s", line.ID)
+	}
+	if installments < 1 || installments > line.MaxInstallments {
+		return nil, fmt.Errorf("parcelas fora dos limites da linha %s", line.ID)
+	}
+
+	rate := line.MonthlyRate / 100
+	payment := amount / float64(installments)
+	if rate > 0 {
+		payment = amount * rate / (1 - math.Pow(1+rate, -float64(installments)))
+	}
+	payment = roundCents(payment)
+
+	daily, additional := defaultIOFDaily, defaultIOFAdditional
+	if f.IOF.Daily != nil {
+		daily = *f.IOF.Daily
+	}
+	if f.IOF.Additional != nil {
+		additional = *f.IOF.Additional
+	}
+
+	sim := &LoanSimulation{Line: line, Amount: amount, Installments: installments, Payment: payment}
+	balance := amount
+	iof := amount * additional / 100
+	for n := 1; n <= installments; n++ {
+		interest := roundCents(balance * rate)
+		amortization := payment - interest
+		if n == installments {
+			// A última parcela absorve a diferença dos arredondamentos
+			amortization = balance
+		}
+		balance = roundCents(balance - amortization)
+		installment := LoanInstallment{
+			Number:       n,
+			Payment:      roundCents(interest + amortization),
+			Interest:     interest,
+			Amortization: roundCents(amortization),
+			Balance:      balance,
+		}
+		sim.Schedule = append(sim.Schedule, installment)
+		sim.Total += installment.Payment
+		sim.Interest += interest
+		iof += installment.Amortization * daily / 100 * float64(min(30*n, iofMaxDays))
+	}
+	if line.IOFExempt {
+		iof = 0
+	}
+	sim.Total = roundCents(sim.Total)
+	sim.Interest = roundCents(sim.Interest)
+	sim.IOF = roundCents(iof)
+	sim.Released = roundCents(amount - sim.IOF - line.Fee)
+	if sim.Released <= 0 {
+		return nil, fmt.Errorf("valor liberado não positivo na linha %s", line.ID)
+	}
+
+	monthly := internalRate(sim.Released, sim.Schedule)
+	sim.CETMonthly = monthly * 100
+	sim.CETYearly = (math.Pow(1+monthly, 12) - 1) * 100
+	return sim, nil
+}
+
+// Primeiras parcelas, para o resumo
+func (s *LoanSimulation) Preview() []LoanInstallment {
+	return s.Schedule[:min(loanPreviewInstallments, len(s.Schedule))]
+}
+
+// Resumo de uma linha para o chamado (ex: "Empréstimo Pessoal: R$ 5.000,00 em 12x de R$ 472,51")
+func (s *LoanSimulation) Summary() string {
+	return fmt.Sprintf("%s: %s em %dx de %s", s.Line.Name, FormatBRL(s.Amount), s.Installments, FormatBRL(s.Payment))
+}
+
+// Taxa mensal que iguala o valor presente das parcelas ao valor liberado
+// (busca binária; o valor presente cai à medida que a taxa sobe)
+func internalRate(released float64, schedule []LoanInstallment) float64 {
+	presentValue := func(rate float64) float64 {
+		total := 0.0
+		for _, installment := range schedule {
+			total += installment.Payment / math.Pow(1+rate, float64(installment.Number))
+		}
+		return total
+	}
+	low, high := 0.0, 1.0
+	if presentValue(low) <= released {
+		return 0
+	}
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if presentValue(mid) > released {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+func roundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// ParseAmount interpreta valores digitados como "5000", "5.000", "5.000,50",
+// "5000,50" ou "R$ 5.000"
+func ParseAmount(text string) (float64, bool) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	text = strings.TrimPrefix(text, "r$")
+	text = strings.ReplaceAll(text, " ", "")
+	if text == "" {
+		return 0, false
+	}
+	if strings.Contains(text, ",") {
+		// Formato brasileiro: pontos separam milhares, vírgula os centavos
+		text = strings.ReplaceAll(text, ".", "")
+		text = strings.Replace(text, ",", ".", 1)
+	} else if parts := strings.Split(text, "."); len(parts) > 1 && len(parts[len(parts)-1]) == 3 {
+		// "5.000" ou "1.500.000": pontos de milhar
+		text = strings.Join(parts, "")
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	// ParseFloat aceita "nan" e "inf", que passariam pelos limites da linha
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 {
+		return 0, false
+	}
+	return roundCents(value), true
+}
+
+// Registra o stage de simulação de empréstimos
+func registerEmprestimosStage() {
+	RegisterStage(&Stage{
+		ID:          "emprestimos",
+		Name:        "Empréstimos",
+		Description: "Simulação de empréstimo pela tabela Price e solicitação",
+		Handler:     emprestimosHandler,
+		NextStages:  []string{"default"},
+		IsOwner:     false,
+		IsGroup:     false,
+		IsPrivate:   true, // Valores da simulação não são enviados em grupos
+		Templates: []string{
+			"emprestimos", "emprestimos_valor", "emprestimos_valor_invalido",
+			"emprestimos_parcelas", "emprestimos_parcelas_invalidas",
+			"emprestimos_simulacao", "emprestimos_solicitado", "emprestimos_indisponivel",
+			"erro_voltar", "erro_sistema",
+		},
+		Options: []StageOption{
+			{ID: "1", Title: "Solicitar", Description: "Solicitar o empréstimo simulado"},
+			{ID: "2", Title: "Nova simulação", Description: "Simular outros valores"},
+			{ID: "0", Title: "Menu principal", Description: "Voltar ao menu principal"},
+		},
+	})
+}
+
+// Handler do stage de empréstimos. Etapas (userStage.Data["step"]): escolha
+// da linha de crédito → valor → parcelas → resultado (solicitar ou simular
+// novamente). A solicitação abre um chamado com os valores simulados.
+func emprestimosHandler(conn *IClient, m *IMessage, userStage *UserStage) bool {
+	userID := m.Sender.ToNonAD().User
+	text := strings.ToLower(strings.TrimSpace(m.Text))
+	step, _ := userStage.Data["step"].(string)
+
+	log := m.Log.With("component", "emprestimos")
+	log.Debug("Etapa da simulação", "step", step)
+
+	switch text {
+	case "0", "voltar", "menu", "início", "inicio":
+		err := ChangeUserStage(conn.Session.ID, userID, conn.Session.RootStage)
+		if err != nil {
+			m.Reply(conn.Render(m, "erro_voltar", map[string]interface{}{"Erro": err.Error()}))
+			return false
+		}
+		if rootStage := GetStage(conn.Session.RootStage); rootStage != nil && rootStage.Handler != nil {
+			userStage, _ := GetUserStage(conn.Session.ID, userID)
+			rootStage.Handler(conn, m, userStage)
+		}
+		return true
+	}
+
+	lines, err := LoadCreditLines(conn.Config)
+	if err != nil {
+		log.Error("Erro ao carregar linhas de crédito", "error", err)
+		m.Reply(conn.Render(m, "emprestimos_indisponivel", nil))
+		return true
+	}
+	line := lines.Find(stringValue(userStage.Data["linha"]))
+
+	switch step {
+	case "linha":
+		chosen := lines.Find(text)
+		if chosen == nil {
+			return replyCreditLines(conn, m, userStage, lines)
+		}
+		userStage.Data = map[string]interface{}{"step": "valor", "linha": chosen.ID}
+		saveEmprestimosStep(userStage)
+		m.Reply(conn.Render(m, "emprestimos_valor", creditLineVars(chosen)))
+		return true
+
+	case "valor":
+		if line == nil {
+			// Linha removida do arquivo durante a conversa
+			return replyCreditLines(conn, m, userStage, lines)
+		}
+		amount, ok := ParseAmount(text)
+		if !ok || amount < line.MinAmount || amount > line.MaxAmount {
+			m.Reply(conn.Render(m, "emprestimos_valor_invalido", creditLineVars(line)))
+			return true
+		}
+		userStage.Data["step"] = "parcelas"
+		userStage.Data["valor"] = amount
+		saveEmprestimosStep(userStage)
+		vars := creditLineVars(line)
+		vars["Valor"] = amount
+		m.Reply(conn.Render(m, "emprestimos_parcelas", vars))
+		return true
+
+	case "parcelas":
+		if line == nil {
+			return replyCreditLines(conn, m, userStage, lines)
+		}
+		installments, err := strconv.Atoi(strings.TrimSuffix(text, "x"))
+		if err != nil || installments < 1 || installments > line.MaxInstallments {
+			m.Reply(conn.Render(m, "emprestimos_parcelas_invalidas", creditLineVars(line)))
+			return true
+		}
+		sim, err := lines.SimulateLoan(line, numberValue(userStage.Data["valor"]), installments)
+		if err != nil {
+			// Limites alterados no arquivo durante a conversa: recomeça
+			log.Warn("Simulação recusada", "error", err)
+			return replyCreditLines(conn, m, userStage, lines)
+		}
+		userStage.Data["step"] = "resultado"
+		userStage.Data["parcelas"] = installments
+		saveEmprestimosStep(userStage)
+		log.Info("Empréstimo simulado", "linha", line.ID, "parcelas", installments)
+		m.ReplyMenu(GetStage("emprestimos"), conn.Render(m, "emprestimos_simulacao", simulationVars(sim)))
+		return true
+
+	case "resultado":
+		switch text {
+		case "1", "solicitar", "sim":
+			return requestLoan(conn, m, userStage, lines, line)
+		case "2", "nova", "simular", "nova simulação", "nova simulacao":
+			return replyCreditLines(conn, m, userStage, lines)
+		}
+		if line != nil {
+			sim, err := lines.SimulateLoan(line, numberValue(userStage.Data["valor"]), int(numberValue(userStage.Data["parcelas"])))
+			if err == nil {
+				m.ReplyMenu(GetStage("emprestimos"), conn.Render(m, "emprestimos_simulacao", simulationVars(sim)))
+				return true
+			}
+		}
+		return replyCreditLines(conn, m, userStage, lines)
+
+	default:
+		return replyCreditLines(conn, m, userStage, lines)
+	}
+}
+
+// Abre o chamado com os valores simulados e volta para a escolha da linha
+func requestLoan(conn *IClient, m *IMessage, userStage *UserStage, lines *CreditLinesFile, line *CreditLine) bool {
+	log := m.Log.With("component", "emprestimos")
+	if line == nil {
+		return replyCreditLines(conn, m, userStage, lines)
+	}
+	sim, err := lines.SimulateLoan(line, numberValue(userStage.Data["valor"]), int(numberValue(userStage.Data["parcelas"])))
+	if err != nil {
+		log.Warn("Simulação recusada", "error", err)
+		return replyCreditLines(conn, m, userStage, lines)
+	}
+
+	ticket := &Ticket{
+		SessionID: userStage.SessionID,
+		UserID:    userStage.UserID,
+		Kind:      "emprestimo",
+		Summary:   sim.Summary(),
+		Data: map[string]interface{}{
+			"linha":       line.ID,
+			"linha_nome":  line.Name,
+			"taxa_mensal": line.MonthlyRate,
+			"valor":       sim.Amount,
+			"parcelas":    sim.Installments,
+			"parcela":     sim.Payment,
+			"total":       sim.Total,
+			"iof":         sim.IOF,
+			"tarifa":      line.Fee,
+			"liberado":    sim.Released,
+			"cet_mensal":  roundCents(sim.CETMonthly),
+			"cet_anual":   roundCents(sim.CETYearly),
+			"nome":        m.Info.PushName,
+			"protocolo":   Protocol(m),
+		},
+	}
+	if err := CreateTicket(ticket); err != nil {
+		log.Error("Erro ao abrir chamado", "error", err)
+		m.Reply(conn.Render(m, "erro_sistema", nil))
+		return false
+	}
+	log.Info("Solicitação de empréstimo registrada", "ticket", ticket.ID, "linha", line.ID)
+
+	userStage.Data = map[string]interface{}{}
+	saveEmprestimosStep(userStage)
+	m.Reply(conn.Render(m, "emprestimos_solicitado", map[string]interface{}{
+		"Chamado": ticket.ID,
+		"Resumo":  ticket.Summary,
+	}))
+	return true
+}
+
+// Lista as linhas de crédito e aguarda a escolha
+func replyCreditLines(conn *IClient, m *IMessage, userStage *UserStage, lines *CreditLinesFile) bool {
+	userStage.Data = map[string]interface{}{"step": "linha"}
+	saveEmprestimosStep(userStage)
+
+	var items []map[string]interface{}
+	for i, line := range lines.Lines {
+		vars := creditLineVars(line)
+		vars["Numero"] = i + 1
+		items = append(items, vars)
+	}
+	m.Reply(conn.Render(m, "emprestimos", map[string]interface{}{"Linhas": items}))
+	return true
+}
+
+func creditLineVars(line *CreditLine) map[string]interface{} {
+	return map[string]interface{}{
+		"Linha":    line.Name,
+		"Taxa":     line.MonthlyRate,
+		"Parcelas": line.MaxInstallments,
+		"Minimo":   line.MinAmount,
+		"Maximo":   line.MaxAmount,
+	}
+}
+
+func simulationVars(sim *LoanSimulation) map[string]interface{} {
+	var preview []map[string]interface{}
+	for _, installment := range sim.Preview() {
+		preview = append(preview, map[string]interface{}{
+			"Numero":      installment.Number,
+			"Parcela":     installment.Payment,
+			"Juros":       installment.Interest,
+			"Amortizacao": installment.Amortization,
+			"Saldo":       installment.Balance,
+		})
+	}
+	return map[string]interface{}{
+		"Linha":      sim.Line.Name,
+		"Taxa":       sim.Line.MonthlyRate,
+		"Valor":      sim.Amount,
+		"Parcelas":   sim.Installments,
+		"Parcela":    sim.Payment,
+		"Total":      sim.Total,
+		"Juros":      sim.Interest,
+		"IOF":        sim.IOF,
+		"Tarifa":     sim.Line.Fee,
+		"Liberado":   sim.Released,
+		"CETMensal":  sim.CETMonthly,
+		"CETAnual":   sim.CETYearly,
+		"Cronograma": preview,
+		"Restantes":  sim.Installments - len(preview),
+	}
+}
+
+// Texto guardado em userStage.Data ("" se ausente). Números voltam como
+// float64 após passar por JSON e são lidos com numberValue.
+func stringValue(value interface{}) string {
+	text, _ := value.(string)
+	return text
+}
+
+func saveEmprestimosStep(userStage *UserStage) {
+	if err := SaveUserStage(userStage); err != nil {
+		helpers.Logger("emprestimos").Error("Erro ao salvar etapa", "session", userStage.SessionID, "user", userStage.UserID, "error", err)
+	}
+}
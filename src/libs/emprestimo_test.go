@@ -0,0 +1,139 @@
+package libs
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimulateLoan(t *testing.T) {
+	tests := []struct {
+		name         string
+		line         *CreditLine
+		amount       float64
+		installments int
+		payment      float64
+		last         float64 // Última parcela, com a diferença dos arredondamentos
+		total        float64
+		iof          float64
+		released     float64
+		cetMonthly   float64
+		cetYearly    float64
+	}{
+		{
+			name:   "pessoal",
+			line:   &CreditLine{ID: "pessoal", MonthlyRate: 1.99, MaxInstallments: 36, MinAmount: 500, MaxAmount: 30000},
+			amount: 5000, installments: 12,
+			payment: 472.51, last: 472.49, total: 5670.10,
+			iof: 101.84, released: 4898.16,
+			cetMonthly: 2.33, cetYearly: 31.78,
+		},
+		{
+			name:   "tarifa descontada do valor liberado",
+			line:   &CreditLine{ID: "consignado", MonthlyRate: 1.49, MaxInstallments: 48, MinAmount: 1000, MaxAmount: 50000, Fee: 50},
+			amount: 10000, installments: 24,
+			payment: 498.66, last: 498.69, total: 11967.87,
+			iof: 275.74, released: 9674.26,
+			cetMonthly: 1.78, cetYearly: 23.54,
+		},
+		{
+			name:   "isento de IOF",
+			line:   &CreditLine{ID: "emergencial", MonthlyRate: 0.99, MaxInstallments: 12, MinAmount: 200, MaxAmount: 3000, IOFExempt: true},
+			amount: 1000, installments: 3,
+			payment: 339.96, last: 339.94, total: 1019.86,
+			iof: 0, released: 1000,
+			cetMonthly: 0.99, cetYearly: 12.55,
+		},
+		{
+			name:   "sem juros",
+			line:   &CreditLine{ID: "zero", MonthlyRate: 0, MaxInstallments: 12, MinAmount: 100, MaxAmount: 3000, IOFExempt: true},
+			amount: 1000, installments: 3,
+			payment: 333.33, last: 333.34, total: 1000,
+			iof: 0, released: 1000,
+			cetMonthly: 0, cetYearly: 0,
+		},
+	}
+
+	file := &CreditLinesFile{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim, err := file.SimulateLoan(tt.line, tt.amount, tt.installments)
+			if err != nil {
+				t.Fatalf("SimulateLoan: %v", err)
+			}
+			if len(sim.Schedule) != tt.installments {
+				t.Fatalf("%d parcelas, esperado %d", len(sim.Schedule), tt.installments)
+			}
+			last := sim.Schedule[len(sim.Schedule)-1]
+
+			for _, c := range []struct {
+				field     string
+				got, want float64
+				tolerance float64
+			}{
+				{"Payment", sim.Payment, tt.payment, 0.001},
+				{"última parcela", last.Payment, tt.last, 0.001},
+				{"saldo final", last.Balance, 0, 0.001},
+				{"Total", sim.Total, tt.total, 0.001},
+				{"Interest", sim.Interest, roundCents(tt.total - tt.amount), 0.001},
+				{"IOF", sim.IOF, tt.iof, 0.001},
+				{"Released", sim.Released, tt.released, 0.001},
+				{"CETMonthly", sim.CETMonthly, tt.cetMonthly, 0.01},
+				{"CETYearly", sim.CETYearly, tt.cetYearly, 0.01},
+			} {
+				if math.Abs(c.got-c.want) > c.tolerance {
+					t.Errorf("%s = %.4f, esperado %.2f", c.field, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSimulateLoanLimits(t *testing.T) {
+	line := &CreditLine{ID: "pessoal", MonthlyRate: 1.99, MaxInstallments: 36, MinAmount: 500, MaxAmount: 30000}
+	file := &CreditLinesFile{}
+
+	for _, tt := range []struct {
+		amount       float64
+		installments int
+	}{
+		{499.99, 12},
+		{30000.01, 12},
+		{5000, 0},
+		{5000, 37},
+	} {
+		if _, err := file.SimulateLoan(line, tt.amount, tt.installments); err == nil {
+			t.Errorf("SimulateLoan(%.2f, %d) sem erro fora dos limites", tt.amount, tt.installments)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		text  string
+		value float64
+		ok    bool
+	}{
+		{"5000", 5000, true},
+		{"5.000", 5000, true},
+		{"5.000,50", 5000.50, true},
+		{"5000,50", 5000.50, true},
+		{"R$ 5.000", 5000, true},
+		{"1.500.000", 1500000, true},
+		{"10.5", 10.50, true},
+		{"", 0, false},
+		{"abc", 0, false},
+		{"0", 0, false},
+		{"-100", 0, false},
+		{"nan", 0, false},
+		{"NaN", 0, false},
+		{"inf", 0, false},
+		{"-Inf", 0, false},
+		{"1e400", 0, false},
+	}
+	for _, tt := range tests {
+		value, ok := ParseAmount(tt.text)
+		if ok != tt.ok || value != tt.value {
+			t.Errorf("ParseAmount(%q) = %v, %v; esperado %v, %v", tt.text, value, ok, tt.value, tt.ok)
+		}
+	}
+}
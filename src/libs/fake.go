@@ -0,0 +1,222 @@
+package libs
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Mensagem registrada pelo FakeTransport
+type SentMessage struct {
+	To      types.JID
+	Message *waE2E.Message
+	ID      types.MessageID
+}
+
+// Texto da mensagem enviada (texto simples, legenda ou corpo do menu)
+func (s SentMessage) Text() string {
+	msg := s.Message
+	switch {
+	case msg.GetConversation() != "":
+		return msg.GetConversation()
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetText()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetCaption()
+	case msg.GetListMessage() != nil:
+		return msg.GetListMessage().GetDescription()
+	case msg.GetButtonsMessage() != nil:
+		return msg.GetButtonsMessage().GetContentText()
+	}
+	return ""
+}
+
+// FakeTransport é um Transport em memória: registra as mensagens enviadas,
+// uploads, presenças e leituras, sem conexão com o WhatsApp.
+type FakeTransport struct {
+	mu        sync.Mutex
+	Sent      []SentMessage
+	Uploads   [][]byte
+	Presences []types.ChatPresence
+	Read      []types.MessageID
+	Rejected  []string // IDs das chamadas recusadas
+	Groups    map[types.JID]*types.GroupInfo
+	Media     map[string][]byte // Conteúdo devolvido por Download, pela DirectPath
+
+	// Erro devolvido por SendMessage (ex: para testar o fallback)
+	SendError error
+	// Erros devolvidos pelos próximos envios, um por envio, antes de SendError
+	SendErrors []error
+	// Simula a conexão caída (IsConnected = false)
+	Disconnected bool
+
+	counter int
+}
+
+// NewFakeClient cria um IClient sobre um FakeTransport para a sessão (ou a
+// sessão padrão, se nil)
+func NewFakeClient(session *Session) (*IClient, *FakeTransport) {
+	if session == nil {
+		session = DefaultSession()
+	}
+	fake := &FakeTransport{
+		Groups: make(map[types.JID]*types.GroupInfo),
+		Media:  make(map[string][]byte),
+	}
+	return &IClient{Transport: fake, Session: session, Config: session.Config}, fake
+}
+
+func (f *FakeTransport) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.SendErrors) > 0 {
+		err := f.SendErrors[0]
+		f.SendErrors = f.SendErrors[1:]
+		if err != nil {
+			return whatsmeow.SendResponse{}, err
+		}
+	}
+	if f.SendError != nil {
+		return whatsmeow.SendResponse{}, f.SendError
+	}
+	f.counter++
+	id := types.MessageID(fmt.Sprintf("FAKE%08d", f.counter))
+	if len(extra) > 0 && extra[0].ID != "" {
+		id = extra[0].ID
+	}
+	f.Sent = append(f.Sent, SentMessage{To: to, Message: message, ID: id})
+	return whatsmeow.SendResponse{ID: id, Timestamp: time.Now()}, nil
+}
+
+func (f *FakeTransport) IsConnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.Disconnected
+}
+
+func (f *FakeTransport) GenerateMessageID() types.MessageID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counter++
+	return types.MessageID(fmt.Sprintf("FAKE%08d", f.counter))
+}
+
+func (f *FakeTransport) Upload(ctx context.Context, data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Uploads = append(f.Uploads, data)
+	sum := sha256.Sum256(data)
+	return whatsmeow.UploadResponse{
+		URL:        fmt.Sprintf("https://fake.invalid/%x", sum[:8]),
+		DirectPath: fmt.Sprintf("/fake/%x", sum[:8]),
+		MediaKey:   sum[:],
+		FileSHA256: sum[:],
+		FileLength: uint64(len(data)),
+	}, nil
+}
+
+func (f *FakeTransport) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, ok := f.Media[msg.GetDirectPath()]
+	if !ok {
+		return nil, fmt.Errorf("mídia %s não cadastrada no FakeTransport", msg.GetDirectPath())
+	}
+	return data, nil
+}
+
+func (f *FakeTransport) SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Presences = append(f.Presences, state)
+	return nil
+}
+
+func (f *FakeTransport) MarkRead(ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Read = append(f.Read, ids...)
+	return nil
+}
+
+func (f *FakeTransport) RejectCall(callFrom types.JID, callID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Rejected = append(f.Rejected, callID)
+	return nil
+}
+
+func (f *FakeTransport) BuildReaction(chat, sender types.JID, id types.MessageID, reaction string) *waE2E.Message {
+	return &waE2E.Message{
+		ReactionMessage: &waE2E.ReactionMessage{
+			Key: &waCommon.MessageKey{
+				RemoteJID: proto.String(chat.String()),
+				ID:        proto.String(id),
+			},
+			Text:              proto.String(reaction),
+			SenderTimestampMS: proto.Int64(time.Now().UnixMilli()),
+		},
+	}
+}
+
+func (f *FakeTransport) GetGroupInfo(jid types.JID) (*types.GroupInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, ok := f.Groups[jid]
+	if !ok {
+		return nil, fmt.Errorf("grupo %s não cadastrado no FakeTransport", jid)
+	}
+	return info, nil
+}
+
+// Cópia das mensagens enviadas até agora
+func (f *FakeTransport) Messages() []SentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]SentMessage(nil), f.Sent...)
+}
+
+// Textos das mensagens enviadas, na ordem de envio
+func (f *FakeTransport) Texts() []string {
+	var texts []string
+	for _, sent := range f.Messages() {
+		texts = append(texts, sent.Text())
+	}
+	return texts
+}
+
+// Última mensagem enviada (nil se nenhuma)
+func (f *FakeTransport) Last() *SentMessage {
+	messages := f.Messages()
+	if len(messages) == 0 {
+		return nil
+	}
+	return &messages[len(messages)-1]
+}
+
+// Descarta as mensagens registradas
+func (f *FakeTransport) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Sent = nil
+	f.Uploads = nil
+	f.Presences = nil
+	f.Read = nil
+	f.Rejected = nil
+}
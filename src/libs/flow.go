@@ -0,0 +1,248 @@
+package libs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Transição entre stages declarada em NextStages
+type FlowEdge struct {
+	From    string
+	To      string
+	Missing bool // O destino não está registrado
+}
+
+// FlowGraph é o grafo de atendimento montado a partir dos stages registrados
+type FlowGraph struct {
+	Roots       []string // Stages raiz das sessões
+	Stages      []*Stage // Stages registrados, ordenados por ID
+	Edges       []FlowEdge
+	Missing     []string // Destinos de NextStages que não estão registrados
+	Unreachable []string // Stages registrados que não são alcançados a partir das raízes
+}
+
+// BuildFlowGraph monta o grafo dos stages registrados a partir das raízes
+// informadas (ou do stage raiz de cada sessão carregada)
+func BuildFlowGraph(roots ...string) *FlowGraph {
+	if len(roots) == 0 {
+		roots = sessionRoots()
+	}
+	graph := &FlowGraph{Roots: roots}
+
+	registry := currentStages()
+	for _, id := range sortedStageIDs(registry) {
+		graph.Stages = append(graph.Stages, registry[id])
+	}
+
+	missing := make(map[string]bool)
+	for _, stage := range graph.Stages {
+		for _, next := range stage.NextStages {
+			edge := FlowEdge{From: stage.ID, To: next, Missing: GetStage(next) == nil}
+			if edge.Missing && !missing[next] {
+				missing[next] = true
+				graph.Missing = append(graph.Missing, next)
+			}
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+	sort.Strings(graph.Missing)
+
+	reachable := graph.Reachable()
+	for _, stage := range graph.Stages {
+		if !reachable[stage.ID] {
+			graph.Unreachable = append(graph.Unreachable, stage.ID)
+		}
+	}
+	return graph
+}
+
+// Reachable devolve os stages registrados alcançáveis a partir das raízes
+func (g *FlowGraph) Reachable() map[string]bool {
+	reachable := make(map[string]bool)
+	queue := append([]string{}, g.Roots...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		stage := GetStage(id)
+		if stage == nil || reachable[id] {
+			continue
+		}
+		reachable[id] = true
+		queue = append(queue, stage.NextStages...)
+	}
+	return reachable
+}
+
+// DOT gera o grafo no formato do Graphviz (dot -Tsvg)
+func (g *FlowGraph) DOT() string {
+	var out strings.Builder
+	out.WriteString("digraph atendimento {\n")
+	out.WriteString("  rankdir=LR;\n")
+	out.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\", fontname=\"Helvetica\"];\n")
+	out.WriteString("  edge [fontname=\"Helvetica\"];\n\n")
+
+	unreachable := toSet(g.Unreachable)
+	roots := toSet(g.Roots)
+	for _, stage := range g.Stages {
+		attrs := []string{fmt.Sprintf("label=%s", dotQuote(flowLabel(stage)))}
+		switch {
+		case unreachable[stage.ID]:
+			attrs = append(attrs, `fillcolor="#e0e0e0"`, `fontcolor="#757575"`, `style="rounded,filled,dashed"`)
+		case stage.IsOwner:
+			attrs = append(attrs, `fillcolor="#fff3cd"`)
+		case roots[stage.ID]:
+			attrs = append(attrs, `fillcolor="#d4edda"`)
+		}
+		if stage.IsOwner {
+			attrs = append(attrs, "peripheries=2")
+		}
+		fmt.Fprintf(&out, "  %s [%s];\n", dotQuote(stage.ID), strings.Join(attrs, ", "))
+	}
+	for _, id := range g.Missing {
+		fmt.Fprintf(&out, "  %s [label=%s, color=\"#c62828\", fontcolor=\"#c62828\", style=\"rounded,dashed\"];\n",
+			dotQuote(id), dotQuote(id+"\n(não registrado)"))
+	}
+
+	out.WriteString("\n")
+	for _, edge := range g.Edges {
+		attrs := ""
+		if edge.Missing {
+			attrs = ` [color="#c62828", style=dashed]`
+		}
+		fmt.Fprintf(&out, "  %s -> %s%s;\n", dotQuote(edge.From), dotQuote(edge.To), attrs)
+	}
+
+	out.WriteString("\n")
+	out.WriteString("  subgraph cluster_legenda {\n")
+	out.WriteString("    label=\"Legenda\"; fontname=\"Helvetica\"; style=dashed;\n")
+	out.WriteString("    legenda_raiz [label=\"Stage raiz\", fillcolor=\"#d4edda\"];\n")
+	out.WriteString("    legenda_owner [label=\"Apenas owners\", fillcolor=\"#fff3cd\", peripheries=2];\n")
+	out.WriteString("    legenda_inalcancavel [label=\"Inalcançável\", fillcolor=\"#e0e0e0\", fontcolor=\"#757575\", style=\"rounded,filled,dashed\"];\n")
+	out.WriteString("    legenda_ausente [label=\"Não registrado\", color=\"#c62828\", fontcolor=\"#c62828\", style=\"rounded,dashed\"];\n")
+	out.WriteString("  }\n")
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// Mermaid gera o grafo no formato do Mermaid (flowchart)
+func (g *FlowGraph) Mermaid() string {
+	var out strings.Builder
+	out.WriteString("flowchart LR\n")
+
+	unreachable := toSet(g.Unreachable)
+	roots := toSet(g.Roots)
+	for _, stage := range g.Stages {
+		label := mermaidQuote(strings.ReplaceAll(flowLabel(stage), "\n", "<br/>"))
+		id := mermaidID(stage.ID)
+		if stage.IsOwner {
+			fmt.Fprintf(&out, "  %s{{%s}}\n", id, label)
+		} else {
+			fmt.Fprintf(&out, "  %s(%s)\n", id, label)
+		}
+		switch {
+		case unreachable[stage.ID]:
+			fmt.Fprintf(&out, "  class %s inalcancavel\n", id)
+		case stage.IsOwner:
+			fmt.Fprintf(&out, "  class %s owner\n", id)
+		case roots[stage.ID]:
+			fmt.Fprintf(&out, "  class %s raiz\n", id)
+		}
+	}
+	for _, missing := range g.Missing {
+		fmt.Fprintf(&out, "  %s[%s]\n", mermaidID(missing), mermaidQuote(missing+"<br/>(não registrado)"))
+		fmt.Fprintf(&out, "  class %s ausente\n", mermaidID(missing))
+	}
+
+	for i, edge := range g.Edges {
+		if edge.Missing {
+			fmt.Fprintf(&out, "  %s -.-> %s\n", mermaidID(edge.From), mermaidID(edge.To))
+			fmt.Fprintf(&out, "  linkStyle %d stroke:#c62828\n", i)
+		} else {
+			fmt.Fprintf(&out, "  %s --> %s\n", mermaidID(edge.From), mermaidID(edge.To))
+		}
+	}
+
+	out.WriteString("  classDef raiz fill:#d4edda\n")
+	out.WriteString("  classDef owner fill:#fff3cd\n")
+	out.WriteString("  classDef inalcancavel fill:#e0e0e0,color:#757575,stroke-dasharray:4\n")
+	out.WriteString("  classDef ausente fill:#ffffff,color:#c62828,stroke:#c62828,stroke-dasharray:4\n")
+	return out.String()
+}
+
+// Rótulo do stage: nome, ID e restrições de acesso
+func flowLabel(stage *Stage) string {
+	label := stage.Name
+	if label == "" || label == stage.ID {
+		label = stage.ID
+	} else {
+		label += "\n(" + stage.ID + ")"
+	}
+	var flags []string
+	if stage.IsOwner {
+		flags = append(flags, "owner")
+	}
+	if stage.IsGroup {
+		flags = append(flags, "grupos")
+	}
+	if stage.IsPrivate {
+		flags = append(flags, "privado")
+	}
+	if len(flags) > 0 {
+		label += "\n[" + strings.Join(flags, ", ") + "]"
+	}
+	return label
+}
+
+// Stages raiz das sessões carregadas ("default" se nenhuma)
+func sessionRoots() []string {
+	seen := make(map[string]bool)
+	var roots []string
+	for _, session := range GetSessions() {
+		if !seen[session.RootStage] {
+			seen[session.RootStage] = true
+			roots = append(roots, session.RootStage)
+		}
+	}
+	if len(roots) == 0 {
+		roots = []string{"default"}
+	}
+	return roots
+}
+
+func sortedStageIDs(registry map[string]*Stage) []string {
+	var ids []string
+	for id := range registry {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func dotQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + strings.ReplaceAll(value, "\n", `\n`) + `"`
+}
+
+func mermaidQuote(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, "#quot;") + `"`
+}
+
+// IDs do Mermaid não aceitam hífens e algumas palavras reservadas ("end")
+func mermaidID(id string) string {
+	return "stage_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, id)
+}
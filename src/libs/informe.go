@@ -0,0 +1,453 @@
+package libs
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tentativas de verificação recusadas antes do bloqueio temporário
+const (
+	informeMaxFailures   = 3
+	informeFailureWindow = time.Hour
+)
+
+// Validade da verificação de identidade: depois disso, um novo pedido de
+// informe exige verificar de novo
+const informeVerificationTTL = 15 * time.Minute
+
+// Situação de uma tentativa de entrega do informe
+const (
+	DeliveryQueued   = "queued" // Na fila de envio; a fila registra sent ou failed
+	DeliverySent     = "sent"
+	DeliveryRefused  = "refused"
+	DeliveryNotFound = "not_found"
+	DeliveryFailed   = "failed"
+)
+
+// Cadastro de um membro no índice de documentos (DOCUMENTS_DIR/index.csv)
+type MemberRecord struct {
+	CPF        string
+	Matricula  string
+	Nome       string
+	Telefone   string
+	Nascimento string // Apenas dígitos (ddmmaaaa)
+
+	dir string // Diretório de documentos em que o membro foi encontrado
+}
+
+var yearPattern = regexp.MustCompile(`^\d{4}$`)
+
+// Diretório dos informes de rendimentos (DOCUMENTS_DIR, padrão DATA_DIR/informes).
+//
+//	index.csv             cpf;matricula;nome;telefone;nascimento
+//	<ano>/<cpf>.pdf       informe do ano (também aceita <matricula>.pdf)
+func documentsDir(cfg *config.Config) string {
+	if cfg.DocumentsDir != "" {
+		return cfg.DocumentsDir
+	}
+	return filepath.Join(cfg.DataDir, "informes")
+}
+
+// FindMember procura o membro pelo CPF ou matrícula no índice de documentos.
+// O índice é lido a cada consulta para refletir atualizações sem reiniciar.
+func FindMember(cfg *config.Config, identifier string) (*MemberRecord, error) {
+	identifier = nonDigits.ReplaceAllString(identifier, "")
+	if identifier == "" {
+		return nil, nil
+	}
+
+	dir := documentsDir(cfg)
+	file, err := os.Open(filepath.Join(dir, "index.csv"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) < 5 {
+			continue
+		}
+		record := &MemberRecord{
+			CPF:        nonDigits.ReplaceAllString(fields[0], ""),
+			Matricula:  nonDigits.ReplaceAllString(fields[1], ""),
+			Nome:       strings.TrimSpace(fields[2]),
+			Telefone:   nonDigits.ReplaceAllString(fields[3], ""),
+			Nascimento: nonDigits.ReplaceAllString(fields[4], ""),
+			dir:        dir,
+		}
+		if record.CPF == "" {
+			// Cabeçalho ou linha inválida
+			continue
+		}
+		if record.CPF == identifier || (record.Matricula != "" && record.Matricula == identifier) {
+			return record, nil
+		}
+	}
+}
+
+// Anos com informe disponível para o membro, do mais recente ao mais antigo
+func (r *MemberRecord) DocumentYears() []string {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil
+	}
+	var years []string
+	for _, entry := range entries {
+		if entry.IsDir() && yearPattern.MatchString(entry.Name()) && r.DocumentPath(entry.Name()) != "" {
+			years = append(years, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(years)))
+	return years
+}
+
+// Caminho do informe do ano ("" se não existir)
+func (r *MemberRecord) DocumentPath(year string) string {
+	if !yearPattern.MatchString(year) {
+		return ""
+	}
+	for _, name := range []string{r.CPF, r.Matricula} {
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(r.dir, year, name+".pdf")
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+// Verifica se o número do WhatsApp é o telefone cadastrado do membro,
+// considerando números brasileiros com e sem o nono dígito
+func (r *MemberRecord) MatchesPhone(phone string) bool {
+	return samePhone(r.Telefone, nonDigits.ReplaceAllString(phone, ""))
+}
+
+func samePhone(a string, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return normalizeBRPhone(a) == normalizeBRPhone(b)
+}
+
+// Normaliza para 55 + DDD + 8 dígitos (sem o nono dígito)
+func normalizeBRPhone(phone string) string {
+	if len(phone) == 10 || len(phone) == 11 {
+		phone = "55" + phone
+	}
+	if strings.HasPrefix(phone, "55") && len(phone) == 13 && phone[4] == '9' {
+		phone = phone[:4] + phone[5:]
+	}
+	return phone
+}
+
+// Valida os dígitos verificadores do CPF
+func ValidCPF(cpf string) bool {
+	cpf = nonDigits.ReplaceAllString(cpf, "")
+	if len(cpf) != 11 || strings.Count(cpf, cpf[:1]) == 11 {
+		return false
+	}
+	for _, size := range []int{9, 10} {
+		sum := 0
+		for i := 0; i < size; i++ {
+			sum += int(cpf[i]-'0') * (size + 1 - i)
+		}
+		digit := sum * 10 % 11
+		if digit == 10 {
+			digit = 0
+		}
+		if digit != int(cpf[size]-'0') {
+			return false
+		}
+	}
+	return true
+}
+
+// CPF mascarado para logs (***.456.789-**)
+func MaskCPF(cpf string) string {
+	if len(cpf) != 11 {
+		return "***"
+	}
+	return "***." + cpf[3:6] + "." + cpf[6:9] + "-**"
+}
+
+// Registra uma tentativa de entrega de informe (enfileirada, enviada ou
+// recusada). messageID liga o registro à mensagem da fila de envio.
+func LogInformeDelivery(sessionID string, userID string, cpf string, year string, path string, checksum string, messageID string, status string, detail string) error {
+	_, err := db.Exec(
+		`INSERT INTO informe_deliveries (session_id, user_id, cpf, year, file, sha256, message_id, status, detail, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sessionID, userID, cpf, year, path, checksum, messageID, status, detail, time.Now().Unix(),
+	)
+	if err != nil || status != DeliveryQueued {
+		return err
+	}
+
+	// A fila pode ter concluído o envio antes do registro existir
+	item, err := GetOutboundMessage(messageID)
+	if err != nil || item == nil {
+		return err
+	}
+	switch item.Status {
+	case OutboundSent:
+		return completeInformeDelivery(messageID, DeliverySent, "")
+	case OutboundFailed:
+		return completeInformeDelivery(messageID, DeliveryFailed, item.LastError)
+	}
+	return nil
+}
+
+// Atualiza a entrega enfileirada com o resultado da fila de envio (mensagens
+// que não são informes não têm registro e não são afetadas)
+func completeInformeDelivery(messageID string, status string, detail string) error {
+	if messageID == "" {
+		return nil
+	}
+	_, err := db.Exec(
+		"UPDATE informe_deliveries SET status = ?, detail = ? WHERE message_id = ? AND status = ?",
+		status, detail, messageID, DeliveryQueued,
+	)
+	return err
+}
+
+// Quantidade de verificações recusadas recentes do usuário
+func recentInformeRefusals(sessionID string, userID string) (int, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM informe_deliveries WHERE session_id = ? AND user_id = ? AND status = ? AND created_at >= ?",
+		sessionID, userID, DeliveryRefused, time.Now().Add(-informeFailureWindow).Unix(),
+	).Scan(&count)
+	return count, err
+}
+
+// Registra o stage de informe de rendimentos
+func registerInformeStage() {
+	RegisterStage(&Stage{
+		ID:          "informe",
+		Name:        "Informe de Rendimentos",
+		Description: "Envio do informe de rendimentos após verificação de identidade",
+		Handler:     informeHandler,
+		NextStages:  []string{"default"},
+		IsOwner:     false,
+		IsGroup:     false,
+		IsPrivate:   true, // Documentos nunca são enviados em grupos
+		Templates: []string{
+			"informe_inicio", "informe_nascimento", "informe_nao_verificado",
+			"informe_bloqueado", "informe_anos", "informe_nao_encontrado",
+			"informe_enviado", "informe_legenda", "informe_expirado", "erro_voltar", "erro_sistema",
+		},
+	})
+}
+
+// Handler do stage de informe de rendimentos. Etapas (userStage.Data["step"]):
+// identificação (CPF ou matrícula) → data de nascimento → escolha do ano.
+// O número que solicita precisa ser o telefone cadastrado do membro.
+func informeHandler(conn *IClient, m *IMessage, userStage *UserStage) bool {
+	userID := m.Sender.ToNonAD().User
+	text := strings.ToLower(strings.TrimSpace(m.Text))
+	step, _ := userStage.Data["step"].(string)
+
+	log := m.Log.With("component", "informe")
+	log.Debug("Etapa do informe", "step", step)
+
+	switch text {
+	case "0", "voltar", "menu", "início", "inicio":
+		err := ChangeUserStage(conn.Session.ID, userID, conn.Session.RootStage)
+		if err != nil {
+			m.Reply(conn.Render(m, "erro_voltar", map[string]interface{}{"Erro": err.Error()}))
+			return false
+		}
+		if rootStage := GetStage(conn.Session.RootStage); rootStage != nil && rootStage.Handler != nil {
+			userStage, _ := GetUserStage(conn.Session.ID, userID)
+			rootStage.Handler(conn, m, userStage)
+		}
+		return true
+	}
+
+	refusals, err := recentInformeRefusals(conn.Session.ID, userID)
+	if err != nil {
+		log.Error("Erro ao consultar tentativas", "error", err)
+		m.Reply(conn.Render(m, "erro_sistema", nil))
+		return false
+	}
+	if refusals >= informeMaxFailures {
+		log.Warn("Usuário bloqueado por excesso de tentativas")
+		m.Reply(conn.Render(m, "informe_bloqueado", nil))
+		return true
+	}
+
+	switch step {
+	case "identificacao":
+		record, err := FindMember(conn.Config, text)
+		if err != nil {
+			log.Error("Erro ao consultar índice de documentos", "error", err)
+			m.Reply(conn.Render(m, "erro_sistema", nil))
+			return false
+		}
+		if digits := nonDigits.ReplaceAllString(text, ""); record == nil && len(digits) == 11 && !ValidCPF(digits) {
+			// CPF digitado errado não conta como tentativa recusada
+			m.Reply(conn.Render(m, "informe_inicio", nil))
+			return true
+		}
+		if record == nil || !record.MatchesPhone(userID) {
+			// A mesma resposta para cadastro inexistente e número divergente
+			// para não revelar quais CPFs estão cadastrados
+			cpf := ""
+			if record != nil {
+				cpf = record.CPF
+			}
+			refuseInforme(conn, m, cpf, "identificação não confere com o número")
+			return true
+		}
+		userStage.Data["step"] = "nascimento"
+		userStage.Data["cpf"] = record.CPF
+		saveInformeStep(userStage)
+		m.Reply(conn.Render(m, "informe_nascimento", nil))
+		return true
+
+	case "nascimento":
+		cpf, _ := userStage.Data["cpf"].(string)
+		record, err := FindMember(conn.Config, cpf)
+		if err != nil {
+			log.Error("Erro ao consultar índice de documentos", "error", err)
+			m.Reply(conn.Render(m, "erro_sistema", nil))
+			return false
+		}
+		if record == nil || !record.MatchesPhone(userID) || record.Nascimento != nonDigits.ReplaceAllString(text, "") {
+			refuseInforme(conn, m, cpf, "data de nascimento não confere")
+			userStage.Data = map[string]interface{}{"step": "identificacao"}
+			saveInformeStep(userStage)
+			return true
+		}
+		userStage.Data["step"] = "ano"
+		userStage.Data["verified_at"] = time.Now().Unix()
+		saveInformeStep(userStage)
+		log.Info("Identidade verificada", "cpf", MaskCPF(cpf))
+		return replyInformeYears(conn, m, record)
+
+	case "ano":
+		verifiedAt := time.Unix(int64(numberValue(userStage.Data["verified_at"])), 0)
+		if time.Since(verifiedAt) > informeVerificationTTL {
+			log.Info("Verificação expirada")
+			userStage.Data = map[string]interface{}{"step": "identificacao"}
+			saveInformeStep(userStage)
+			m.Reply(conn.Render(m, "informe_expirado", map[string]interface{}{
+				"Minutos": int(informeVerificationTTL.Minutes()),
+			}))
+			return true
+		}
+		cpf, _ := userStage.Data["cpf"].(string)
+		record, err := FindMember(conn.Config, cpf)
+		if err != nil || record == nil || !record.MatchesPhone(userID) {
+			// Cadastro alterado após a verificação: exige nova verificação
+			refuseInforme(conn, m, cpf, "cadastro alterado após a verificação")
+			userStage.Data = map[string]interface{}{"step": "identificacao"}
+			saveInformeStep(userStage)
+			return true
+		}
+		if !yearPattern.MatchString(text) {
+			return replyInformeYears(conn, m, record)
+		}
+		path := record.DocumentPath(text)
+		if path == "" {
+			LogInformeDelivery(conn.Session.ID, userID, record.CPF, text, "", "", "", DeliveryNotFound, "")
+			m.Reply(conn.Render(m, "informe_nao_encontrado", map[string]interface{}{"Ano": text}))
+			return replyInformeYears(conn, m, record)
+		}
+		return sendInforme(conn, m, record, text, path)
+
+	default:
+		userStage.Data["step"] = "identificacao"
+		saveInformeStep(userStage)
+		m.Reply(conn.Render(m, "informe_inicio", nil))
+		return true
+	}
+}
+
+// Lista os anos disponíveis ou informa que não há documentos
+func replyInformeYears(conn *IClient, m *IMessage, record *MemberRecord) bool {
+	years := record.DocumentYears()
+	if len(years) == 0 {
+		m.Reply(conn.Render(m, "informe_nao_encontrado", nil))
+		return true
+	}
+	m.Reply(conn.Render(m, "informe_anos", map[string]interface{}{
+		"Nome": record.Nome,
+		"Anos": years,
+	}))
+	return true
+}
+
+func sendInforme(conn *IClient, m *IMessage, record *MemberRecord, year string, path string) bool {
+	userID := m.Sender.ToNonAD().User
+	log := m.Log.With("component", "informe", "year", year, "cpf", MaskCPF(record.CPF))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Error("Erro ao ler informe", "path", path, "error", err)
+		LogInformeDelivery(conn.Session.ID, userID, record.CPF, year, path, "", "", DeliveryFailed, err.Error())
+		m.Reply(conn.Render(m, "erro_sistema", nil))
+		return false
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	caption := conn.Render(m, "informe_legenda", map[string]interface{}{"Ano": year})
+	fileName := fmt.Sprintf("informe-rendimentos-%s.pdf", year)
+	resp, err := conn.SendDocument(m.Info.Chat, data, fileName, caption, nil)
+	if err != nil {
+		log.Error("Erro ao enviar informe", "error", err)
+		LogInformeDelivery(conn.Session.ID, userID, record.CPF, year, path, checksum, "", DeliveryFailed, err.Error())
+		m.Reply(conn.Render(m, "erro_sistema", nil))
+		return false
+	}
+
+	// Pela fila, o envio só é confirmado quando a fila entrega a mensagem
+	status := DeliverySent
+	if conn.queued() {
+		status = DeliveryQueued
+	}
+	if err := LogInformeDelivery(conn.Session.ID, userID, record.CPF, year, path, checksum, resp.ID, status, ""); err != nil {
+		log.Error("Erro ao registrar entrega", "error", err)
+	}
+	log.Info("Informe enviado", "status", status, "message_id", resp.ID)
+	m.Reply(conn.Render(m, "informe_enviado", map[string]interface{}{"Ano": year}))
+	return true
+}
+
+// Registra a recusa e responde sem revelar o motivo
+func refuseInforme(conn *IClient, m *IMessage, cpf string, reason string) {
+	userID := m.Sender.ToNonAD().User
+	m.Log.Warn("Verificação recusada", "component", "informe", "reason", reason)
+	if err := LogInformeDelivery(conn.Session.ID, userID, cpf, "", "", "", "", DeliveryRefused, reason); err != nil {
+		m.Log.Error("Erro ao registrar recusa", "component", "informe", "error", err)
+	}
+	m.Reply(conn.Render(m, "informe_nao_verificado", nil))
+}
+
+func saveInformeStep(userStage *UserStage) {
+	if err := SaveUserStage(userStage); err != nil {
+		helpers.Logger("informe").Error("Erro ao salvar etapa", "session", userStage.SessionID, "user", userStage.UserID, "error", err)
+	}
+}
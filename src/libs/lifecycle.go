@@ -0,0 +1,119 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Controle do ciclo de vida do processo: acompanha o trabalho em andamento
+// (handlers de stage, envios) para que o desligamento possa aguardar o
+// término antes de desconectar e fechar os bancos de dados.
+var lifecycle = struct {
+	sync.Mutex
+	draining bool
+	nextID   uint64
+	inFlight map[uint64]string
+	idle     chan struct{}
+	hooks    []shutdownHook
+}{
+	inFlight: make(map[uint64]string),
+}
+
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// BeginWork registra uma unidade de trabalho em andamento. Retorna ok=false
+// quando o processo já está desligando e novos eventos não devem ser aceitos.
+// A função done deve ser chamada ao final do trabalho.
+func BeginWork(description string) (done func(), ok bool) {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+
+	if lifecycle.draining {
+		return func() {}, false
+	}
+
+	lifecycle.nextID++
+	id := lifecycle.nextID
+	lifecycle.inFlight[id] = description
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			lifecycle.Lock()
+			defer lifecycle.Unlock()
+			delete(lifecycle.inFlight, id)
+			if len(lifecycle.inFlight) == 0 && lifecycle.idle != nil {
+				close(lifecycle.idle)
+				lifecycle.idle = nil
+			}
+		})
+	}, true
+}
+
+// IsDraining informa se o desligamento já foi iniciado
+func IsDraining() bool {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	return lifecycle.draining
+}
+
+// RegisterShutdownHook registra uma função executada durante o desligamento,
+// depois que o trabalho em andamento terminou (ex: esvaziar filas pendentes).
+// Os hooks rodam na ordem de registro.
+func RegisterShutdownHook(name string, fn func(ctx context.Context) error) {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	lifecycle.hooks = append(lifecycle.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Drain para de aceitar novo trabalho e aguarda o término do que está em
+// andamento até o prazo do contexto. Retorna a descrição do trabalho que
+// ainda estava em andamento quando o prazo expirou.
+func Drain(ctx context.Context) []string {
+	lifecycle.Lock()
+	lifecycle.draining = true
+	if len(lifecycle.inFlight) == 0 {
+		lifecycle.Unlock()
+		return nil
+	}
+	if lifecycle.idle == nil {
+		lifecycle.idle = make(chan struct{})
+	}
+	idle := lifecycle.idle
+	lifecycle.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	abandoned := make([]string, 0, len(lifecycle.inFlight))
+	for _, description := range lifecycle.inFlight {
+		abandoned = append(abandoned, description)
+	}
+	sort.Strings(abandoned)
+	return abandoned
+}
+
+// RunShutdownHooks executa os hooks registrados e retorna os erros encontrados
+func RunShutdownHooks(ctx context.Context) []error {
+	lifecycle.Lock()
+	hooks := append([]shutdownHook(nil), lifecycle.hooks...)
+	lifecycle.Unlock()
+
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", hook.name, err))
+		}
+	}
+	return errs
+}
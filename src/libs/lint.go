@@ -0,0 +1,141 @@
+package libs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Regras verificadas pelo lint do fluxo
+const (
+	LintDuplicateStage  = "duplicate-stage"
+	LintMissingStage    = "missing-stage"
+	LintMissingRoot     = "missing-root"
+	LintNoWayBack       = "no-way-back"
+	LintUnreachable     = "unreachable"
+	LintMissingTemplate = "missing-template"
+)
+
+// Problema encontrado no fluxo de atendimento
+type LintIssue struct {
+	Rule    string
+	Stage   string // "" para problemas que não são de um stage
+	Message string
+	Warning bool // Avisos não reprovam o lint (exceto no modo estrito)
+}
+
+func (issue LintIssue) String() string {
+	level := "erro"
+	if issue.Warning {
+		level = "aviso"
+	}
+	if issue.Stage == "" {
+		return fmt.Sprintf("%s [%s] %s", level, issue.Rule, issue.Message)
+	}
+	return fmt.Sprintf("%s [%s] %s: %s", level, issue.Rule, issue.Stage, issue.Message)
+}
+
+// LintStages verifica os stages registrados: IDs registrados mais de uma vez,
+// NextStages apontando para stages inexistentes, stages sem caminho de volta
+// ao stage raiz, stages inalcançáveis e templates ausentes. Requer InitStages
+// e LoadTemplates.
+func LintStages() []LintIssue {
+	var issues []LintIssue
+	graph := BuildFlowGraph()
+	roots := toSet(graph.Roots)
+
+	for _, root := range graph.Roots {
+		if GetStage(root) == nil {
+			issues = append(issues, LintIssue{
+				Rule:    LintMissingRoot,
+				Stage:   root,
+				Message: "stage raiz de sessão não está registrado",
+			})
+		}
+	}
+
+	registrations := StageRegistrations()
+	for _, id := range sortedStageIDs(currentStages()) {
+		if sources := registrations[id]; len(sources) > 1 {
+			issues = append(issues, LintIssue{
+				Rule:    LintDuplicateStage,
+				Stage:   id,
+				Message: fmt.Sprintf("registrado %d vezes (%s); apenas o último registro vale", len(sources), strings.Join(sources, ", ")),
+			})
+		}
+	}
+
+	for _, edge := range graph.Edges {
+		if edge.Missing {
+			issues = append(issues, LintIssue{
+				Rule:    LintMissingStage,
+				Stage:   edge.From,
+				Message: fmt.Sprintf("NextStages aponta para '%s', que não está registrado", edge.To),
+			})
+		}
+	}
+
+	for _, stage := range graph.Stages {
+		if roots[stage.ID] || reachesAny(stage.ID, roots) {
+			continue
+		}
+		issues = append(issues, LintIssue{
+			Rule:    LintNoWayBack,
+			Stage:   stage.ID,
+			Message: fmt.Sprintf("nenhum caminho em NextStages leva de volta a %s", strings.Join(graph.Roots, ", ")),
+		})
+	}
+
+	for _, id := range graph.Unreachable {
+		issues = append(issues, LintIssue{
+			Rule:    LintUnreachable,
+			Stage:   id,
+			Message: fmt.Sprintf("não é alcançado a partir de %s", strings.Join(graph.Roots, ", ")),
+			Warning: true,
+		})
+	}
+
+	catalogMu.RLock()
+	loaded := catalog
+	catalogMu.RUnlock()
+	if loaded == nil {
+		issues = append(issues, LintIssue{Rule: LintMissingTemplate, Message: "catálogo de templates não carregado"})
+	} else {
+		for _, problem := range templateProblems(loaded, currentStages()) {
+			issues = append(issues, LintIssue{
+				Rule:    LintMissingTemplate,
+				Stage:   strings.TrimPrefix(problem.Source, "stage "),
+				Message: fmt.Sprintf("template %s/%s: %s", problem.Locale, problem.Name, problem.Err.Error()),
+				Warning: problem.Locale != loaded.defaultLocale,
+			})
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return !issues[i].Warning && issues[j].Warning
+	})
+	return issues
+}
+
+// Verifica se algum dos destinos é alcançável a partir do stage por NextStages
+func reachesAny(from string, targets map[string]bool) bool {
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		stage := GetStage(queue[0])
+		queue = queue[1:]
+		if stage == nil {
+			continue
+		}
+		for _, next := range stage.NextStages {
+			if targets[next] {
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false
+}
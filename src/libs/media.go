@@ -0,0 +1,298 @@
+package libs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hisoka/src/config"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// Tipos de mídia recebida (mesmos valores de helpers.GetMediaType)
+const (
+	MediaImage    = "image"
+	MediaVideo    = "video"
+	MediaDocument = "document"
+	MediaAudio    = "audio"
+	MediaSticker  = "sticker"
+)
+
+// MediaPolicy define quais mídias um stage aceita. Mídias não aceitas recebem
+// uma resposta automática e não chegam ao handler.
+type MediaPolicy struct {
+	Accept    []string // Tipos aceitos (MediaImage, MediaDocument...)
+	MimeTypes []string // MIME types aceitos (vazio = qualquer um dos tipos aceitos)
+	MaxSize   int64    // Tamanho máximo em bytes (0 = MEDIA_MAX_SIZE)
+}
+
+// Referência a uma mídia recebida e guardada no media store
+type MediaRef struct {
+	ID         int64  `json:"id"`
+	Kind       string `json:"kind"`
+	MimeType   string `json:"mime_type"`
+	FileName   string `json:"file_name,omitempty"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	Path       string `json:"path"`
+	Transcript string `json:"transcript,omitempty"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// Erro de mídia recusada pela política do stage (tipo ou tamanho)
+type MediaRejectedError struct {
+	Reason string
+}
+
+func (e *MediaRejectedError) Error() string {
+	return e.Reason
+}
+
+func (p *MediaPolicy) accepts(kind string) bool {
+	if p == nil {
+		return false
+	}
+	for _, accepted := range p.Accept {
+		if accepted == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *MediaPolicy) acceptsMime(mimeType string) bool {
+	if p == nil || len(p.MimeTypes) == 0 {
+		return true
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	for _, accepted := range p.MimeTypes {
+		if strings.ToLower(accepted) == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *MediaPolicy) maxSize(cfg *config.Config) int64 {
+	if p != nil && p.MaxSize > 0 {
+		return p.MaxSize
+	}
+	return cfg.MediaMaxSize
+}
+
+// Diretório do media store (MEDIA_DIR, padrão DATA_DIR/media)
+func mediaDir(cfg *config.Config) string {
+	if cfg.MediaDir != "" {
+		return cfg.MediaDir
+	}
+	return filepath.Join(cfg.DataDir, "media")
+}
+
+// Tipo da mídia enviada na própria mensagem (ignora mídias citadas)
+func inboundMediaKind(message *waE2E.Message) string {
+	if message.GetImageMessage() != nil {
+		return MediaImage
+	} else if message.GetVideoMessage() != nil || message.GetPtvMessage() != nil {
+		return MediaVideo
+	} else if message.GetDocumentMessage() != nil {
+		return MediaDocument
+	} else if message.GetAudioMessage() != nil {
+		return MediaAudio
+	} else if message.GetStickerMessage() != nil {
+		return MediaSticker
+	}
+	return ""
+}
+
+// applyMediaPolicy trata a mídia recebida conforme a política do stage.
+// Retorna false quando a mensagem já foi respondida e não deve ir ao handler.
+func applyMediaPolicy(conn *IClient, m *IMessage, stage *Stage, userStage *UserStage) bool {
+	kind := inboundMediaKind(m.Message)
+	if kind == "" {
+		return true
+	}
+	caption := strings.TrimSpace(m.Text)
+
+	if !stage.Media.accepts(kind) {
+		m.Log.Info("Mídia recusada pelo stage", "component", "media", "kind", kind, "stage", stage.ID)
+		switch {
+		case kind == MediaAudio && GetTranscriber() != nil && transcribeAudio(conn, m, GetTranscriber()):
+			// Mensagem de voz transcrita: segue para o handler como texto
+			return true
+		case kind == MediaAudio || kind == MediaVideo:
+			m.Reply(conn.Render(m, "midia_audio_video", nil))
+			return false
+		case caption != "":
+			// Imagem ou documento com legenda: a legenda é tratada como texto
+			return true
+		default:
+			m.Reply(conn.Render(m, "midia_nao_aceita", nil))
+			return false
+		}
+	}
+
+	ref, err := StoreInboundMedia(conn, m, stage.Media)
+	if err != nil {
+		m.Log.Error("Erro ao guardar mídia", "component", "media", "kind", kind, "error", err)
+		if rejected, ok := err.(*MediaRejectedError); ok {
+			m.Reply(conn.Render(m, "midia_invalida", map[string]interface{}{
+				"Motivo": rejected.Reason,
+				"Limite": formatSize(stage.Media.maxSize(conn.Config)),
+			}))
+		} else {
+			m.Reply(conn.Render(m, "erro_usuario", map[string]interface{}{"Erro": err.Error()}))
+		}
+		return false
+	}
+
+	m.Attachment = ref
+	AttachMedia(userStage, ref)
+	if err := SaveUserStage(userStage); err != nil {
+		m.Log.Error("Erro ao vincular mídia ao usuário", "component", "media", "error", err)
+	}
+	return true
+}
+
+// StoreInboundMedia baixa a mídia da mensagem, valida tipo e tamanho e guarda
+// no media store, endereçada pelo SHA-256 do conteúdo
+func StoreInboundMedia(conn *IClient, m *IMessage, policy *MediaPolicy) (*MediaRef, error) {
+	ref, _, err := storeInboundMedia(conn, m, policy)
+	return ref, err
+}
+
+func storeInboundMedia(conn *IClient, m *IMessage, policy *MediaPolicy) (*MediaRef, []byte, error) {
+	kind := inboundMediaKind(m.Message)
+	media, mimeType, fileName, declaredSize := inboundMediaInfo(m.Message)
+	if media == nil {
+		return nil, nil, fmt.Errorf("mensagem sem mídia")
+	}
+
+	if !policy.acceptsMime(mimeType) {
+		return nil, nil, &MediaRejectedError{Reason: fmt.Sprintf("formato %s não aceito", mimeType)}
+	}
+	limit := policy.maxSize(conn.Config)
+	if declaredSize > limit {
+		return nil, nil, &MediaRejectedError{Reason: fmt.Sprintf("arquivo maior que %s", formatSize(limit))}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	data, err := conn.Transport.Download(ctx, media)
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, nil, &MediaRejectedError{Reason: fmt.Sprintf("arquivo maior que %s", formatSize(limit))}
+	}
+	// O tipo declarado pelo remetente é conferido com o conteúdo
+	if detected := DetectMime(data, fileName); detected != "application/octet-stream" {
+		mimeType = detected
+	}
+	if !policy.acceptsMime(mimeType) {
+		return nil, nil, &MediaRejectedError{Reason: fmt.Sprintf("formato %s não aceito", mimeType)}
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	path := filepath.Join(mediaDir(conn.Config), checksum[:2], checksum+mediaExtension(mimeType, fileName))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nil, err
+	}
+	// Conteúdo idêntico já guardado não é gravado de novo
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.WriteFile(path, data, 0640); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ref := &MediaRef{
+		Kind:      kind,
+		MimeType:  mimeType,
+		FileName:  fileName,
+		Size:      int64(len(data)),
+		SHA256:    checksum,
+		Path:      path,
+		CreatedAt: time.Now().Unix(),
+	}
+	result, err := db.Exec(
+		`INSERT INTO media_files (session_id, user_id, message_id, kind, mime_type, file_name, size, sha256, path, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		conn.Session.ID, m.Sender.ToNonAD().User, m.Info.ID, ref.Kind, ref.MimeType, ref.FileName, ref.Size, ref.SHA256, ref.Path, ref.CreatedAt,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	ref.ID, _ = result.LastInsertId()
+
+	m.Log.Info("Mídia guardada", "component", "media", "kind", kind, "mime_type", mimeType, "size", formatSize(ref.Size), "media_id", ref.ID)
+	return ref, data, nil
+}
+
+// AttachMedia adiciona a referência da mídia em UserStage.Data["media"]
+func AttachMedia(userStage *UserStage, ref *MediaRef) {
+	attached, _ := userStage.Data["media"].([]interface{})
+	userStage.Data["media"] = append(attached, map[string]interface{}{
+		"id":        ref.ID,
+		"kind":      ref.Kind,
+		"mime_type": ref.MimeType,
+		"sha256":    ref.SHA256,
+	})
+}
+
+// Obtém uma mídia guardada pelo ID
+func GetMedia(id int64) (*MediaRef, error) {
+	var ref MediaRef
+	err := db.QueryRow(
+		"SELECT id, kind, mime_type, file_name, size, sha256, path, transcript, created_at FROM media_files WHERE id = ?", id,
+	).Scan(&ref.ID, &ref.Kind, &ref.MimeType, &ref.FileName, &ref.Size, &ref.SHA256, &ref.Path, &ref.Transcript, &ref.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+func inboundMediaInfo(message *waE2E.Message) (media whatsmeow.DownloadableMessage, mimeType string, fileName string, size int64) {
+	if msg := message.GetImageMessage(); msg != nil {
+		return msg, msg.GetMimetype(), "", int64(msg.GetFileLength())
+	} else if msg := message.GetVideoMessage(); msg != nil {
+		return msg, msg.GetMimetype(), "", int64(msg.GetFileLength())
+	} else if msg := message.GetPtvMessage(); msg != nil {
+		return msg, msg.GetMimetype(), "", int64(msg.GetFileLength())
+	} else if msg := message.GetDocumentMessage(); msg != nil {
+		fileName := ""
+		if msg.GetFileName() != "" {
+			fileName = filepath.Base(msg.GetFileName())
+		}
+		return msg, msg.GetMimetype(), fileName, int64(msg.GetFileLength())
+	} else if msg := message.GetAudioMessage(); msg != nil {
+		return msg, msg.GetMimetype(), "", int64(msg.GetFileLength())
+	} else if msg := message.GetStickerMessage(); msg != nil {
+		return msg, msg.GetMimetype(), "", int64(msg.GetFileLength())
+	}
+	return nil, "", "", 0
+}
+
+func mediaExtension(mimeType string, fileName string) string {
+	if ext := filepath.Ext(fileName); ext != "" {
+		return strings.ToLower(ext)
+	}
+	if exts, _ := mime.ExtensionsByType(strings.SplitN(mimeType, ";", 2)[0]); len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+func formatSize(size int64) string {
+	if size >= 1024*1024 {
+		return strconv.FormatFloat(float64(size)/(1024*1024), 'f', 1, 64) + " MB"
+	}
+	return strconv.FormatInt(size/1024, 10) + " KB"
+}
@@ -0,0 +1,381 @@
+package libs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hisoka/src/config"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Tamanho máximo (maior lado) das miniaturas JPEG enviadas junto com as mídias
+const thumbnailSize = 96
+
+// Figurinhas do WhatsApp são WebP de 512x512
+const stickerSize = 512
+
+// Tempo máximo das ferramentas externas (ffmpeg, ffprobe, pdftoppm)
+const mediaToolTimeout = 30 * time.Second
+
+// Mídia pronta para envio: tipo detectado e metadados preenchidos quando
+// possível (zero/nil quando não foi possível obter)
+type PreparedMedia struct {
+	Data      []byte
+	MimeType  string
+	Thumbnail []byte // Miniatura JPEG
+	Width     uint32
+	Height    uint32
+	Duration  uint32 // Segundos (áudio e vídeo)
+	PageCount uint32 // Páginas (PDF)
+}
+
+// Nós /Pages da árvore de páginas do PDF (com /Count antes ou depois de /Type)
+// e os object streams comprimidos, onde PDFs 1.5+ costumam guardá-los
+var (
+	pdfPagesCount = regexp.MustCompile(`/Type\s*/Pages\b[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages\b`)
+	pdfObjStm     = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+)
+
+// Limite do conteúdo descomprimido de cada object stream
+const pdfMaxObjectStream = 16 << 20
+
+// DetectMime identifica o tipo do arquivo pelos primeiros bytes e, quando
+// eles não bastam (ex: formatos do Office, que são ZIPs), pela extensão
+func DetectMime(data []byte, fileName string) string {
+	byExtension := ""
+	if ext := strings.ToLower(filepath.Ext(fileName)); ext != "" {
+		byExtension = strings.SplitN(mime.TypeByExtension(ext), ";", 2)[0]
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return "application/pdf"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "image/gif"
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return "image/webp"
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return "audio/wav"
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")):
+		switch string(data[8:12]) {
+		case "M4A ", "M4B ":
+			return "audio/mp4"
+		case "qt  ":
+			return "video/quicktime"
+		case "heic", "heix", "mif1":
+			return "image/heic"
+		}
+		return "video/mp4"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		if bytes.Contains(data[:min(len(data), 64)], []byte("OpusHead")) {
+			return "audio/ogg; codecs=opus"
+		}
+		return "audio/ogg"
+	case bytes.HasPrefix(data, []byte("ID3")), len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return "audio/mpeg"
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return "video/webm"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		// docx, xlsx, pptx... são ZIPs: a extensão diz qual é
+		if byExtension != "" {
+			return byExtension
+		}
+		return "application/zip"
+	}
+
+	if byExtension != "" {
+		return byExtension
+	}
+	return strings.SplitN(http.DetectContentType(data), ";", 2)[0]
+}
+
+// PrepareMedia detecta o tipo da mídia e preenche miniatura, dimensões,
+// duração e número de páginas quando possível. Falhas ao obter metadados não
+// impedem o envio. As ferramentas externas (pdftoppm, ffprobe e ffmpeg) vêm
+// da configuração.
+func PrepareMedia(cfg *config.Config, data []byte, fileName string) *PreparedMedia {
+	media := &PreparedMedia{Data: data, MimeType: DetectMime(data, fileName)}
+
+	switch {
+	case strings.HasPrefix(media.MimeType, "image/"):
+		if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+			bounds := img.Bounds()
+			media.Width, media.Height = uint32(bounds.Dx()), uint32(bounds.Dy())
+			media.Thumbnail = jpegThumbnail(img)
+		}
+
+	case media.MimeType == "application/pdf":
+		media.PageCount = pdfPageCount(data)
+		if page, err := renderPDFPage(cfg, data); err == nil {
+			if img, _, err := image.Decode(bytes.NewReader(page)); err == nil {
+				media.Thumbnail = jpegThumbnail(img)
+			}
+		}
+
+	case strings.HasPrefix(media.MimeType, "video/"), strings.HasPrefix(media.MimeType, "audio/"):
+		probeMedia(cfg, media)
+	}
+
+	return media
+}
+
+// Reduz a imagem para a miniatura JPEG
+func jpegThumbnail(img image.Image) []byte {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil
+	}
+	scale := math.Min(1, float64(thumbnailSize)/float64(max(bounds.Dx(), bounds.Dy())))
+	width := max(1, int(float64(bounds.Dx())*scale))
+	height := max(1, int(float64(bounds.Dy())*scale))
+
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(thumb, thumb.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.ApproxBiLinear.Scale(thumb, thumb.Bounds(), img, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 70}); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// Renderiza a primeira página do PDF com o pdftoppm (poppler), se instalado
+func renderPDFPage(cfg *config.Config, data []byte) ([]byte, error) {
+	pdftoppm := toolPath(cfg.PdftoppmBin)
+	if pdftoppm == "" {
+		return nil, fmt.Errorf("pdftoppm não encontrado")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mediaToolTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, pdftoppm, "-jpeg", "-f", "1", "-l", "1", "-scale-to", strconv.Itoa(thumbnailSize*2), "-", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Obtém duração e dimensões com o ffprobe e, para vídeos, a miniatura do
+// primeiro quadro com o ffmpeg (apenas se instalados)
+func probeMedia(cfg *config.Config, media *PreparedMedia) {
+	dir, err := os.MkdirTemp("", "media-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input"+mediaExtension(media.MimeType, ""))
+	if err := os.WriteFile(input, media.Data, 0600); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mediaToolTimeout)
+	defer cancel()
+
+	if ffprobe := toolPath(cfg.FFprobeBin); ffprobe != "" {
+		var out bytes.Buffer
+		cmd := exec.CommandContext(ctx, ffprobe, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", input)
+		cmd.Stdout = &out
+		if cmd.Run() == nil {
+			var probe struct {
+				Format struct {
+					Duration string `json:"duration"`
+				} `json:"format"`
+				Streams []struct {
+					CodecType string `json:"codec_type"`
+					Width     uint32 `json:"width"`
+					Height    uint32 `json:"height"`
+				} `json:"streams"`
+			}
+			if json.Unmarshal(out.Bytes(), &probe) == nil {
+				if seconds, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+					media.Duration = uint32(math.Round(seconds))
+				}
+				for _, stream := range probe.Streams {
+					if stream.CodecType == "video" {
+						media.Width, media.Height = stream.Width, stream.Height
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if !strings.HasPrefix(media.MimeType, "video/") {
+		return
+	}
+	if ffmpeg := toolPath(cfg.Transcriber.FFmpeg); ffmpeg != "" {
+		frame := filepath.Join(dir, "frame.jpg")
+		cmd := exec.CommandContext(ctx, ffmpeg, "-nostdin", "-loglevel", "error", "-i", input, "-frames:v", "1", frame)
+		if cmd.Run() == nil {
+			if data, err := os.ReadFile(frame); err == nil {
+				if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+					media.Thumbnail = jpegThumbnail(img)
+				}
+			}
+		}
+	}
+}
+
+// ToWebPSticker converte a imagem em uma figurinha válida: WebP 512x512, com
+// a imagem centralizada sobre fundo transparente. Usa o ffmpeg (libwebp).
+func ToWebPSticker(cfg *config.Config, data []byte) ([]byte, error) {
+	if DetectMime(data, "") == "image/webp" {
+		if width, height, ok := webpSize(data); ok && width == stickerSize && height == stickerSize {
+			return data, nil
+		}
+	}
+
+	ffmpeg := toolPath(cfg.Transcriber.FFmpeg)
+	if ffmpeg == "" {
+		return nil, fmt.Errorf("ffmpeg não encontrado para converter a figurinha")
+	}
+
+	dir, err := os.MkdirTemp("", "sticker-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input"+mediaExtension(DetectMime(data, ""), ""))
+	output := filepath.Join(dir, "sticker.webp")
+	if err := os.WriteFile(input, data, 0600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mediaToolTimeout)
+	defer cancel()
+
+	filter := fmt.Sprintf(
+		"scale=%d:%d:force_original_aspect_ratio=decrease,format=rgba,pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=0x00000000",
+		stickerSize, stickerSize, stickerSize, stickerSize,
+	)
+	if err := runCommand(ctx, ffmpeg, "-nostdin", "-loglevel", "error", "-i", input, "-vf", filter,
+		"-c:v", "libwebp", "-lossless", "0", "-q:v", "80", "-loop", "0", "-an", "-frames:v", "1", output); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+	return os.ReadFile(output)
+}
+
+// Dimensões de um WebP (formatos VP8, VP8L e VP8X)
+func webpSize(data []byte) (uint32, uint32, bool) {
+	if len(data) < 30 {
+		return 0, 0, false
+	}
+	switch string(data[12:16]) {
+	case "VP8 ":
+		return uint32(binary.LittleEndian.Uint16(data[26:28]) & 0x3FFF), uint32(binary.LittleEndian.Uint16(data[28:30]) & 0x3FFF), true
+	case "VP8L":
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return bits&0x3FFF + 1, (bits>>14)&0x3FFF + 1, true
+	case "VP8X":
+		width := uint32(data[24]) | uint32(data[25])<<8 | uint32(data[26])<<16
+		height := uint32(data[27]) | uint32(data[28])<<8 | uint32(data[29])<<16
+		return width + 1, height + 1, true
+	}
+	return 0, 0, false
+}
+
+// Número de páginas do PDF: o /Count da raiz da árvore de páginas. Cada nó
+// /Pages conta as páginas abaixo dele, então a raiz tem o maior /Count. Os nós
+// guardados em object streams (FlateDecode) também são lidos. Retorna 0 se
+// não encontrar a árvore.
+func pdfPageCount(data []byte) uint32 {
+	count := maxPagesCount(data)
+	for _, stream := range pdfObjectStreams(data) {
+		count = max(count, maxPagesCount(stream))
+	}
+	return count
+}
+
+func maxPagesCount(data []byte) uint32 {
+	var count uint32
+	for _, match := range pdfPagesCount.FindAllSubmatch(data, -1) {
+		digits := match[1]
+		if len(digits) == 0 {
+			digits = match[2]
+		}
+		if n, err := strconv.ParseUint(string(digits), 10, 32); err == nil {
+			count = max(count, uint32(n))
+		}
+	}
+	return count
+}
+
+// Conteúdo descomprimido dos object streams (/Type /ObjStm) do PDF
+func pdfObjectStreams(data []byte) [][]byte {
+	var streams [][]byte
+	for offset := 0; ; {
+		index := bytes.Index(data[offset:], []byte("stream"))
+		if index < 0 {
+			return streams
+		}
+		start := offset + index
+		offset = start + len("stream")
+		if bytes.HasSuffix(data[:start], []byte("end")) {
+			continue
+		}
+
+		// Dicionário do objeto: do "N 0 obj" mais próximo até "stream"
+		window := data[max(0, start-1024):start]
+		if objStart := bytes.LastIndex(window, []byte("obj")); objStart < 0 || !pdfObjStm.Match(window[objStart:]) {
+			continue
+		}
+
+		body := data[offset:]
+		if bytes.HasPrefix(body, []byte("\r\n")) {
+			body = body[2:]
+		} else if bytes.HasPrefix(body, []byte("\n")) {
+			body = body[1:]
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		inflated, _ := io.ReadAll(io.LimitReader(reader, pdfMaxObjectStream))
+		reader.Close()
+		if len(inflated) > 0 {
+			streams = append(streams, inflated)
+		}
+	}
+}
+
+// Caminho da ferramenta configurada (nome no PATH ou caminho); "" se não
+// estiver instalada
+func toolPath(name string) string {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,139 @@
+package libs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDetectMime(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		fileName string
+		want     string
+	}{
+		{"PDF", []byte("%PDF-1.7\n%âãÏÓ"), "", "application/pdf"},
+		{"PDF com extensão errada", []byte("%PDF-1.4\n"), "foto.jpg", "application/pdf"},
+		{"JPEG", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F'}, "", "image/jpeg"},
+		{"PNG", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "", "image/png"},
+		{"GIF87a", []byte("GIF87a\x01\x00"), "", "image/gif"},
+		{"GIF89a", []byte("GIF89a\x01\x00"), "", "image/gif"},
+		{"WebP", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "", "image/webp"},
+		{"WAV", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "", "audio/wav"},
+		{"MP4", []byte("\x00\x00\x00\x18ftypisom"), "", "video/mp4"},
+		{"M4A", []byte("\x00\x00\x00\x18ftypM4A "), "", "audio/mp4"},
+		{"QuickTime", []byte("\x00\x00\x00\x14ftypqt  "), "", "video/quicktime"},
+		{"HEIC", []byte("\x00\x00\x00\x18ftypheic"), "", "image/heic"},
+		{"Ogg Opus", []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00OpusHead"), "", "audio/ogg; codecs=opus"},
+		{"Ogg", []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00\x01vorbis"), "", "audio/ogg"},
+		{"MP3 com ID3", []byte("ID3\x04\x00\x00"), "", "audio/mpeg"},
+		{"MP3 sem ID3", []byte{0xFF, 0xFB, 0x90, 0x64}, "", "audio/mpeg"},
+		{"WebM", []byte{0x1A, 0x45, 0xDF, 0xA3, 0x9F}, "", "video/webm"},
+		{"DOCX", []byte("PK\x03\x04\x14\x00"), "contrato.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"ZIP sem extensão", []byte("PK\x03\x04\x14\x00"), "", "application/zip"},
+		{"texto pela extensão", []byte("cpf;matricula"), "index.csv", "text/csv"},
+		{"texto sem extensão", []byte("olá"), "", "text/plain"},
+		{"vazio", nil, "", "text/plain"},
+		{"binário desconhecido", []byte{0x00, 0x01, 0x02, 0x03}, "", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectMime(tt.data, tt.fileName); got != tt.want {
+				t.Errorf("DetectMime(% x, %q) = %q, esperado %q", tt.data, tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
+
+// Cabeçalho RIFF/WEBP com o primeiro chunk e os bytes informados a partir do
+// offset 20 (início dos dados do chunk)
+func webpHeader(chunk string, payload ...byte) []byte {
+	data := append([]byte("RIFF\x00\x00\x00\x00WEBP"+chunk+"\x00\x00\x00\x00"), payload...)
+	for len(data) < 30 {
+		data = append(data, 0)
+	}
+	return data
+}
+
+func TestWebPSize(t *testing.T) {
+	le16 := func(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+	lossy := append([]byte{0x9D, 0x01, 0x2A, 0x9D, 0x01, 0x2A}, append(le16(512), le16(300)...)...)
+	lossless := binary.LittleEndian.AppendUint32([]byte{0x2F}, (400-1)|(200-1)<<14)
+
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height uint32
+		ok            bool
+	}{
+		{"VP8", webpHeader("VP8 ", lossy...), 512, 300, true},
+		{"VP8 com bits de escala", webpHeader("VP8 ", append(lossy[:6], append(le16(0xC000|512), le16(0x4000|512)...)...)...), 512, 512, true},
+		{"VP8L", webpHeader("VP8L", lossless...), 400, 200, true},
+		{"VP8X", webpHeader("VP8X", 0x10, 0, 0, 0, 0xFF, 0x01, 0x00, 0xFF, 0x01, 0x00), 512, 512, true},
+		{"VP8X grande", webpHeader("VP8X", 0, 0, 0, 0, 0x7F, 0x38, 0x00, 0x37, 0x1F, 0x00), 14464, 7992, true},
+		{"chunk desconhecido", webpHeader("ALPH"), 0, 0, false},
+		{"curto demais", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, ok := webpSize(tt.data)
+			if width != tt.width || height != tt.height || ok != tt.ok {
+				t.Errorf("webpSize = %d, %d, %v; esperado %d, %d, %v", width, height, ok, tt.width, tt.height, tt.ok)
+			}
+		})
+	}
+}
+
+// Object stream comprimido com o conteúdo informado
+func pdfObjectStream(content string) string {
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	writer.Write([]byte(content))
+	writer.Close()
+	return "9 0 obj\n<< /Type /ObjStm /N 2 /First 10 /Filter /FlateDecode /Length 99 >>\nstream\r\n" + buf.String() + "\r\nendstream\nendobj\n"
+}
+
+func TestPDFPageCount(t *testing.T) {
+	tests := []struct {
+		name string
+		pdf  string
+		want uint32
+	}{
+		{
+			"árvore simples",
+			"%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+				"2 0 obj\n<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>\nendobj\n" +
+				"3 0 obj\n<< /Type /Page /Parent 2 0 R >>\nendobj\n4 0 obj\n<< /Type /Page /Parent 2 0 R >>\nendobj\n",
+			2,
+		},
+		{
+			"árvore com nós intermediários",
+			"%PDF-1.4\n2 0 obj\n<</Count 5/Kids[3 0 R 6 0 R]/Type/Pages>>\nendobj\n" +
+				"3 0 obj\n<</Type/Pages/Parent 2 0 R/Kids[4 0 R 5 0 R]/Count 2>>\nendobj\n" +
+				"6 0 obj\n<</Type/Pages/Parent 2 0 R/Kids[7 0 R 8 0 R 9 0 R]/Count 3>>\nendobj\n",
+			5,
+		},
+		{
+			"páginas fora do texto",
+			"%PDF-1.5\n2 0 obj\n<< /Type /Pages /Count 12 /Kids [3 0 R] >>\nendobj\n3 0 obj\n<< /Type /Page >>\nendobj\n",
+			12,
+		},
+		{
+			"árvore em object stream",
+			"%PDF-1.5\n%âãÏÓ\n" + pdfObjectStream("1 0 2 48 << /Type /Catalog /Pages 2 0 R >> << /Type /Pages /Kids [3 0 R] /Count 7 >>") +
+				"10 0 obj\n<< /Type /XRef /Size 11 /Root 1 0 R >>\nstream\nxref\nendstream\nendobj\n",
+			7,
+		},
+		{"sem árvore de páginas", "%PDF-1.4\n3 0 obj\n<< /Type /Page >>\nendobj\n", 0},
+		{"vazio", "%PDF-1.4\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdfPageCount([]byte(tt.pdf)); got != tt.want {
+				t.Errorf("pdfPageCount = %d, esperado %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package libs
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Limites do WhatsApp para mensagens interativas
+const (
+	maxButtons        = 3
+	maxButtonTitle    = 20
+	maxListRows       = 10 // somadas todas as seções
+	maxListRowTitle   = 24
+	maxListRowDetails = 72
+)
+
+// Seção de uma mensagem de lista
+type ListSection struct {
+	Title   string
+	Options []StageOption
+}
+
+// SendList envia uma mensagem de lista; o ID da linha escolhida volta em IMessage.SelectedID
+func (conn *IClient) SendList(to types.JID, title string, body string, buttonText string, footer string, sections []ListSection, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error) {
+	rows := 0
+	for _, section := range sections {
+		rows += len(section.Options)
+	}
+	if rows > maxListRows {
+		return whatsmeow.SendResponse{}, fmt.Errorf("mensagens de lista aceitam no máximo %d opções", maxListRows)
+	}
+
+	return conn.send(to, listMessage(title, body, buttonText, footer, sections, opts), nil)
+}
+
+func listMessage(title string, body string, buttonText string, footer string, sections []ListSection, opts *waE2E.ContextInfo) *waE2E.Message {
+	var listSections []*waE2E.ListMessage_Section
+	for _, section := range sections {
+		var rows []*waE2E.ListMessage_Row
+		for _, option := range section.Options {
+			rows = append(rows, &waE2E.ListMessage_Row{
+				RowID:       proto.String(option.ID),
+				Title:       proto.String(truncate(option.Title, maxListRowTitle)),
+				Description: proto.String(truncate(option.Description, maxListRowDetails)),
+			})
+		}
+		listSections = append(listSections, &waE2E.ListMessage_Section{
+			Title: proto.String(section.Title),
+			Rows:  rows,
+		})
+	}
+
+	return &waE2E.Message{
+		ListMessage: &waE2E.ListMessage{
+			Title:       proto.String(title),
+			Description: proto.String(body),
+			ButtonText:  proto.String(buttonText),
+			ListType:    waE2E.ListMessage_SINGLE_SELECT.Enum(),
+			Sections:    listSections,
+			FooterText:  proto.String(footer),
+			ContextInfo: opts,
+		},
+	}
+}
+
+// SendButtons envia uma mensagem com até 3 botões de resposta
+func (conn *IClient) SendButtons(to types.JID, body string, footer string, options []StageOption, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error) {
+	if len(options) > maxButtons {
+		return whatsmeow.SendResponse{}, fmt.Errorf("mensagens de botões aceitam no máximo %d opções", maxButtons)
+	}
+
+	return conn.send(to, buttonsMessage(body, footer, options, opts), nil)
+}
+
+func buttonsMessage(body string, footer string, options []StageOption, opts *waE2E.ContextInfo) *waE2E.Message {
+	var buttons []*waE2E.ButtonsMessage_Button
+	for _, option := range options {
+		buttons = append(buttons, &waE2E.ButtonsMessage_Button{
+			ButtonID: proto.String(option.ID),
+			ButtonText: &waE2E.ButtonsMessage_Button_ButtonText{
+				DisplayText: proto.String(truncate(option.Title, maxButtonTitle)),
+			},
+			Type: waE2E.ButtonsMessage_Button_RESPONSE.Enum(),
+		})
+	}
+
+	return &waE2E.Message{
+		ButtonsMessage: &waE2E.ButtonsMessage{
+			ContentText: proto.String(body),
+			FooterText:  proto.String(footer),
+			Buttons:     buttons,
+			HeaderType:  waE2E.ButtonsMessage_EMPTY.Enum(),
+			ContextInfo: opts,
+		},
+	}
+}
+
+// SendStageMenu envia o menu de um stage como botões (até 3 opções) ou lista
+// (até 10), gerados a partir de Stage.Options. Se os menus interativos
+// estiverem desligados, o stage não tiver opções ou tiver mais opções do que
+// uma lista comporta, envia o texto numerado recebido: o WhatsApp aceita a
+// lista acima do limite mas não a exibe, e o fallback nunca seria usado.
+// Se o envio interativo falhar, o texto é enviado no lugar.
+func (conn *IClient) SendStageMenu(to types.JID, stage *Stage, fallback string, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error) {
+	if stage == nil || len(stage.Options) == 0 || len(stage.Options) > maxListRows || !conn.Config.InteractiveMenus {
+		return conn.SendText(to, fallback, opts)
+	}
+
+	var interactive *waE2E.Message
+	if len(stage.Options) <= maxButtons {
+		interactive = buttonsMessage(fallback, stage.Name, stage.Options, opts)
+	} else {
+		interactive = listMessage(stage.Name, fallback, "Ver opções", "", []ListSection{
+			{Title: stage.Name, Options: stage.Options},
+		}, opts)
+	}
+
+	return conn.send(to, interactive, &waE2E.Message{
+		ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        proto.String(fallback),
+			ContextInfo: opts,
+		},
+	})
+}
+
+// Extrai o ID da opção escolhida em respostas de lista, botões ou fluxos nativos
+func selectedOptionID(message *waE2E.Message) string {
+	if id := message.GetListResponseMessage().GetSingleSelectReply().GetSelectedRowID(); id != "" {
+		return id
+	} else if id := message.GetButtonsResponseMessage().GetSelectedButtonID(); id != "" {
+		return id
+	} else if id := message.GetTemplateButtonReplyMessage().GetSelectedID(); id != "" {
+		return id
+	} else if params := message.GetInteractiveResponseMessage().GetNativeFlowResponseMessage().GetParamsJSON(); params != "" {
+		var payload struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal([]byte(params), &payload) == nil {
+			return payload.ID
+		}
+	}
+	return ""
+}
+
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
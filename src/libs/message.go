@@ -1,27 +1,21 @@
 package libs
 
 import (
-	"context"
+	"fmt"
 	"hisoka/src/helpers"
-	"os"
-	"regexp"
 	"strings"
+	"time"
 
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
-	waTypes "go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	"google.golang.org/protobuf/proto"
 )
 
 func SerializeMessage(mess *events.Message, conn *IClient) *IMessage {
-	var media whatsmeow.DownloadableMessage
-	var text string
-	var args []string
-	var owner []string
 	var isOwner = false
-	var isMedia string
-	var sender waTypes.JID
+	var sender types.JID
 
 	if mess.Info.AddressingMode == "lid" {
 		sender = mess.Info.SenderAlt
@@ -31,62 +25,134 @@ func SerializeMessage(mess *events.Message, conn *IClient) *IMessage {
 
 	mess.Message = helpers.ParseMessage(mess)
 	body := helpers.GetTextMessage(mess)
-	owner = strings.Split(os.Getenv("OWNER"), ",")
+	isOwner = conn.Session.IsOwner(sender.ToNonAD().User)
 
-	for _, v := range owner {
-		if strings.Contains(regexp.MustCompile(`\D+`).ReplaceAllString(v, ""), sender.ToNonAD().User) {
-			isOwner = true
-		}
+	if conn.WA != nil && strings.HasPrefix(body, "@"+conn.WA.Store.ID.ToNonAD().User) {
+		body = strings.Trim(strings.Replace(body, "@"+conn.WA.Store.ID.ToNonAD().User, "", 1), " ")
 	}
 
-	if strings.HasPrefix(body, "@"+conn.WA.Store.ID.ToNonAD().User) {
-		body = strings.Trim(strings.Replace(body, "@"+conn.WA.Store.ID.ToNonAD().User, "", 1), " ")
+	return buildMessage(conn, mess.Info, sender, isOwner, mess.Message, body)
+}
+
+// Parâmetros para montar um IMessage sem um events.Message (ex: testes)
+type MessageParams struct {
+	ID        types.MessageID // Gerado se vazio
+	Chat      types.JID       // Conversa; se vazio, a conversa privada com o remetente
+	Sender    types.JID
+	PushName  string
+	Text      string
+	Message   *waE2E.Message // Se nil, uma mensagem de texto com Text
+	Timestamp time.Time      // Agora se vazio
+}
+
+// NewMessage monta um IMessage como se tivesse sido recebido pelo WhatsApp,
+// com Reply/ReplyMenu/React enviando pelo Transport do cliente
+func NewMessage(conn *IClient, params MessageParams) *IMessage {
+	if params.Chat.IsEmpty() {
+		params.Chat = params.Sender.ToNonAD()
+	}
+	if params.ID == "" {
+		params.ID = types.MessageID(fmt.Sprintf("3EB0%016X", time.Now().UnixNano()))
+	}
+	if params.Timestamp.IsZero() {
+		params.Timestamp = time.Now()
+	}
+	if params.Message == nil {
+		params.Message = &waE2E.Message{Conversation: proto.String(params.Text)}
+	}
+
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:    params.Chat,
+			Sender:  params.Sender,
+			IsGroup: params.Chat.Server == types.GroupServer,
+		},
+		ID:        params.ID,
+		PushName:  params.PushName,
+		Timestamp: params.Timestamp,
+		Type:      "text",
+	}
+	body := params.Text
+	if body == "" {
+		body = params.Message.GetConversation()
 	}
+	isOwner := conn.Session.IsOwner(params.Sender.ToNonAD().User)
+	return buildMessage(conn, info, params.Sender, isOwner, params.Message, body)
+}
+
+// NewTextMessage monta a mensagem de texto enviada pelo número em conversa privada
+func NewTextMessage(conn *IClient, phone string, text string) *IMessage {
+	return NewMessage(conn, MessageParams{
+		Sender: types.NewJID(phone, types.DefaultUserServer),
+		Text:   text,
+	})
+}
 
-	text = body
-	args = helpers.ArrayFilter(strings.Split(body, " "), "")
+func buildMessage(conn *IClient, info types.MessageInfo, sender types.JID, isOwner bool, message *waE2E.Message, body string) *IMessage {
+	var media whatsmeow.DownloadableMessage
+	var isMedia string
+
+	text := body
+	args := helpers.ArrayFilter(strings.Split(body, " "), "")
 
-	quotedMsg := helpers.ParseQuotedMessage(mess.Message)
+	quotedMsg := helpers.ParseQuotedMessage(message)
 
 	if quotedMsg != nil {
 		media = helpers.GetMediaMessage(quotedMsg)
 		isMedia = helpers.GetMediaType(quotedMsg)
-	} else if mess.Message != nil {
-		media = helpers.GetMediaMessage(mess.Message)
-		isMedia = helpers.GetMediaType(mess.Message)
+	} else if message != nil {
+		media = helpers.GetMediaMessage(message)
+		isMedia = helpers.GetMediaType(message)
 	} else {
 		media = nil
 	}
 
+	correlationID := helpers.NewCorrelationID()
+	sessionID := ""
+	if conn.Session != nil {
+		sessionID = conn.Session.ID
+	}
+
 	return &IMessage{
-		Info:       mess.Info,
-		Sender:     sender,
-		IsOwner:    isOwner,
-		Body:       body,
-		Text:       text,
-		Args:       args,
-		Command:    "", // Não usado mais no sistema de stages
-		Message:    mess.Message,
-		IsMedia:    isMedia,
-		Media:      media,
-		Expiration: helpers.GetContextInfo(mess.Message).GetExpiration(),
-		Quoted:     helpers.GetContextInfo(mess.Message),
+		Info:          info,
+		Sender:        sender,
+		IsOwner:       isOwner,
+		Body:          body,
+		Text:          text,
+		Args:          args,
+		Command:       "", // Não usado mais no sistema de stages
+		Message:       message,
+		IsMedia:       isMedia,
+		Media:         media,
+		Expiration:    helpers.GetContextInfo(message).GetExpiration(),
+		Quoted:        helpers.GetContextInfo(message),
+		SelectedID:    selectedOptionID(message),
+		CorrelationID: correlationID,
+		Log:           helpers.Log().With("correlation_id", correlationID, "session", sessionID, "user", sender.ToNonAD().User),
 		Reply: func(text string, opts ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
 			var Expiration uint32
-			if helpers.GetContextInfo(mess.Message) != nil {
-				Expiration = helpers.GetContextInfo(mess.Message).GetExpiration()
+			if helpers.GetContextInfo(message) != nil {
+				Expiration = helpers.GetContextInfo(message).GetExpiration()
 			} else {
 				Expiration = uint32(0)
 			}
-			return conn.SendText(mess.Info.Chat, text, &waE2E.ContextInfo{
-				StanzaID:      &mess.Info.ID,
-				Participant:   proto.String(mess.Info.Sender.String()),
-				QuotedMessage: mess.Message,
+			return conn.SendText(info.Chat, text, &waE2E.ContextInfo{
+				StanzaID:      &info.ID,
+				Participant:   proto.String(info.Sender.String()),
+				QuotedMessage: message,
 				Expiration:    &Expiration,
 			}, opts...)
 		},
+		ReplyMenu: func(stage *Stage, text string) (whatsmeow.SendResponse, error) {
+			return conn.SendStageMenu(info.Chat, stage, text, &waE2E.ContextInfo{
+				StanzaID:      &info.ID,
+				Participant:   proto.String(info.Sender.String()),
+				QuotedMessage: message,
+				Expiration:    proto.Uint32(helpers.GetContextInfo(message).GetExpiration()),
+			})
+		},
 		React: func(emoji string, opts ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
-			return conn.WA.SendMessage(context.Background(), mess.Info.Chat, conn.WA.BuildReaction(mess.Info.Chat, mess.Info.Sender, mess.Info.ID, emoji), opts...)
+			return conn.send(info.Chat, conn.Transport.BuildReaction(info.Chat, info.Sender, info.ID, emoji), nil, opts...)
 		},
 	}
 }
@@ -0,0 +1,258 @@
+package libs
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"hisoka/src/helpers"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migrações do stages.db: arquivos migrations/NNNN_descricao.sql, aplicados
+// em ordem, cada um em uma transação. Migrações aplicadas não devem ser
+// editadas; mudanças no esquema entram em um arquivo novo.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrações do banco de STATE_DATABASE_URL (STATE_STORE=postgres), que guarda
+// apenas o estado dos usuários; mesmas regras das do stages.db
+//
+//go:embed migrations/postgres/*.sql
+var postgresMigrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.sql$`)
+
+// Conjunto de migrações de um banco, com a própria tabela schema_version
+type migrationSet struct {
+	files   embed.FS
+	dir     string
+	dialect string // "sqlite3" ou "postgres"
+}
+
+var (
+	stagesMigrations   = migrationSet{files: migrationFiles, dir: "migrations", dialect: "sqlite3"}
+	postgresMigrations = migrationSet{files: postgresMigrationFiles, dir: "migrations/postgres", dialect: "postgres"}
+)
+
+// Migração embutida no binário
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Situação de uma migração no banco
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time // Zero se pendente
+	Unknown   bool      // Aplicada no banco, mas ausente deste binário (banco mais novo)
+}
+
+// Migrations lista as migrações embutidas do stages.db, ordenadas pela versão
+func Migrations() ([]Migration, error) {
+	return stagesMigrations.list()
+}
+
+// Versão mais recente do stages.db conhecida por este binário
+func LatestSchemaVersion() int {
+	return stagesMigrations.latest()
+}
+
+// Versão atual do stages.db (0 se nenhuma migração foi aplicada)
+func SchemaVersion() (int, error) {
+	return stagesMigrations.version(db)
+}
+
+// Migrate aplica as migrações pendentes do stages.db. Recusa bancos com versão
+// mais nova que a deste binário (ex: após voltar para uma versão anterior do bot).
+func Migrate() error {
+	// Bancos anteriores ao suporte a várias sessões têm user_stages sem session_id
+	return stagesMigrations.migrate(db, "stages.db", upgradeUserStagesTable)
+}
+
+// MigrationsStatus compara as migrações embutidas com as aplicadas no stages.db
+func MigrationsStatus() ([]MigrationStatus, error) {
+	return stagesMigrations.status(db)
+}
+
+// MigratePostgres aplica as migrações pendentes do banco de estado PostgreSQL
+func MigratePostgres(conn *sql.DB) error {
+	return postgresMigrations.migrate(conn, "STATE_DATABASE_URL", nil)
+}
+
+// PostgresMigrationsStatus compara as migrações do banco de estado PostgreSQL
+// com as aplicadas
+func PostgresMigrationsStatus(conn *sql.DB) ([]MigrationStatus, error) {
+	return postgresMigrations.status(conn)
+}
+
+func (set migrationSet) list() ([]Migration, error) {
+	entries, err := set.files.ReadDir(set.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("nome de migração inválido: %s (use NNNN_descricao.sql)", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		if previous, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrações %s e %s com a mesma versão", previous, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		content, err := set.files.ReadFile(path.Join(set.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: match[2], SQL: string(content)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (set migrationSet) latest() int {
+	migrations, err := set.list()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func (set migrationSet) ensureVersionTable(conn *sql.DB) error {
+	appliedAt := "INTEGER"
+	if set.dialect == "postgres" {
+		appliedAt = "BIGINT"
+	}
+	_, err := conn.Exec(fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at %s NOT NULL
+	)`, appliedAt))
+	return err
+}
+
+func (set migrationSet) version(conn *sql.DB) (int, error) {
+	if err := set.ensureVersionTable(conn); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := conn.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// Aplica as migrações pendentes. adopt, se informado, é chamado antes da
+// primeira migração em bancos sem nenhuma aplicada, para adaptar o esquema
+// anterior às migrações numeradas.
+func (set migrationSet) migrate(conn *sql.DB, label string, adopt func() error) error {
+	migrations, err := set.list()
+	if err != nil {
+		return err
+	}
+	current, err := set.version(conn)
+	if err != nil {
+		return err
+	}
+	if latest := set.latest(); current > latest {
+		return fmt.Errorf("%s está na versão %d do esquema, mais nova que a suportada por este binário (%d); atualize o bot", label, current, latest)
+	}
+
+	if current == 0 && adopt != nil {
+		if err := adopt(); err != nil {
+			return err
+		}
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if err := set.apply(conn, migration); err != nil {
+			return fmt.Errorf("%s: migração %04d_%s: %w", label, migration.Version, migration.Name, err)
+		}
+		helpers.Logger("migrate").Info("Migração aplicada", "database", label, "version", migration.Version, "name", migration.Name)
+	}
+	return nil
+}
+
+func (set migrationSet) apply(conn *sql.DB, migration Migration) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		rebind(set.dialect, "INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)"),
+		migration.Version, migration.Name, time.Now().Unix(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (set migrationSet) status(conn *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := set.list()
+	if err != nil {
+		return nil, err
+	}
+	if err := set.ensureVersionTable(conn); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query("SELECT version, name, applied_at FROM schema_version ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationStatus)
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt int64
+		if err := rows.Scan(&status.Version, &status.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		status.AppliedAt = time.Unix(appliedAt, 0)
+		applied[status.Version] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range migrations {
+		status, ok := applied[migration.Version]
+		if !ok {
+			status = MigrationStatus{Version: migration.Version, Name: migration.Name}
+		}
+		delete(applied, migration.Version)
+		statuses = append(statuses, status)
+	}
+	for _, status := range applied {
+		status.Unknown = true
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
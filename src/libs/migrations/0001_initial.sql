@@ -0,0 +1,111 @@
+-- Esquema inicial. Bancos anteriores às migrações numeradas têm apenas
+-- user_stages (chave user_id), convertida para a chave (session_id, user_id)
+-- antes desta migração; por isso IF NOT EXISTS.
+
+-- Estado dos usuários, separado por sessão
+CREATE TABLE IF NOT EXISTS user_stages (
+	session_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	current_stage TEXT NOT NULL,
+	data TEXT,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (session_id, user_id)
+);
+
+-- Vínculo entre sessões e dispositivos pareados
+CREATE TABLE IF NOT EXISTS bot_sessions (
+	session_id TEXT PRIMARY KEY,
+	device_jid TEXT NOT NULL
+);
+
+-- Histórico de eventos de conexão (diagnóstico)
+CREATE TABLE IF NOT EXISTS connection_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL DEFAULT '',
+	event TEXT NOT NULL,
+	detail TEXT,
+	created_at INTEGER NOT NULL
+);
+
+-- Fila persistida de mensagens enviadas
+CREATE TABLE IF NOT EXISTS outbound_messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	chat TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	payload BLOB NOT NULL,
+	fallback BLOB,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	sent_at INTEGER NOT NULL DEFAULT 0,
+	typing_ms INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_outbound_pending ON outbound_messages (session_id, status, chat, id);
+CREATE INDEX IF NOT EXISTS idx_outbound_message_id ON outbound_messages (message_id);
+
+-- Mídias recebidas e guardadas no media store
+CREATE TABLE IF NOT EXISTS media_files (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	mime_type TEXT NOT NULL,
+	file_name TEXT NOT NULL DEFAULT '',
+	size INTEGER NOT NULL,
+	sha256 TEXT NOT NULL,
+	path TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	transcript TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_media_user ON media_files (session_id, user_id);
+
+-- Chamadas recebidas (recusadas automaticamente)
+CREATE TABLE IF NOT EXISTS call_attempts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	caller TEXT NOT NULL,
+	call_id TEXT NOT NULL,
+	rejected INTEGER NOT NULL DEFAULT 0,
+	replied INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_call_caller ON call_attempts (session_id, caller, created_at);
+
+-- Registro das entregas (e recusas) de informes de rendimentos
+CREATE TABLE IF NOT EXISTS informe_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	cpf TEXT NOT NULL DEFAULT '',
+	year TEXT NOT NULL DEFAULT '',
+	file TEXT NOT NULL DEFAULT '',
+	sha256 TEXT NOT NULL DEFAULT '',
+	message_id TEXT NOT NULL DEFAULT '', -- Mensagem na fila de envio (ver outbound_messages)
+	status TEXT NOT NULL,
+	detail TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_informe_user ON informe_deliveries (session_id, user_id, status, created_at);
+CREATE INDEX IF NOT EXISTS idx_informe_message ON informe_deliveries (message_id);
+
+-- Chamados abertos pelo atendimento para a equipe (atendimento humano,
+-- solicitação de empréstimo), com os dados coletados na conversa em JSON
+CREATE TABLE IF NOT EXISTS tickets (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	status TEXT NOT NULL,
+	summary TEXT NOT NULL DEFAULT '',
+	data TEXT NOT NULL DEFAULT '{}',
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tickets_status ON tickets (session_id, status, id);
+CREATE INDEX IF NOT EXISTS idx_tickets_user ON tickets (session_id, user_id);
@@ -0,0 +1,3 @@
+-- Idioma escolhido pelo usuário, guardado junto do estado (user_stages) para
+-- acompanhar o StateStore configurado
+ALTER TABLE user_stages ADD COLUMN locale TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- Estado dos usuários com STATE_STORE=postgres. As demais tabelas (fila de
+-- envio, mídias, chamadas, chamados...) ficam no stages.db.
+-- IF NOT EXISTS adota bancos criados antes das migrações numeradas
+CREATE TABLE IF NOT EXISTS user_stages (
+	session_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	current_stage TEXT NOT NULL,
+	data TEXT,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	PRIMARY KEY (session_id, user_id)
+);
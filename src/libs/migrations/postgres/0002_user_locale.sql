@@ -0,0 +1,2 @@
+-- Idioma escolhido pelo usuário (ver migrations/0002_user_locale.sql)
+ALTER TABLE user_stages ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,470 @@
+package libs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hisoka/src/helpers"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Status das mensagens da fila de envio
+const (
+	OutboundPending = "pending"
+	OutboundSent    = "sent"
+	OutboundFailed  = "failed"
+)
+
+// Mensagem registrada na fila de envio
+type OutboundMessage struct {
+	ID            int64
+	SessionID     string
+	Chat          string
+	MessageID     string
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt int64
+	CreatedAt     int64
+	UpdatedAt     int64
+	SentAt        int64
+	TypingMs      int64 // Tempo mostrando "digitando..." antes do envio
+
+	payload  []byte
+	fallback []byte
+}
+
+// Transporte da fila: além do Transport, informa se há conexão e gera os IDs
+// das mensagens (o *whatsmeow.Client implementa, assim como o FakeTransport)
+type QueueTransport interface {
+	Transport
+	IsConnected() bool
+	GenerateMessageID() types.MessageID
+}
+
+// SendQueue envia as mensagens de uma sessão a partir de uma fila persistida
+// no stages.db: respeita a ordem por conversa, o ritmo global e por conversa,
+// e tenta novamente os erros transitórios com backoff.
+type SendQueue struct {
+	WA      QueueTransport
+	Session *Session
+
+	MinInterval  time.Duration // Intervalo mínimo entre dois envios quaisquer
+	ChatInterval time.Duration // Intervalo mínimo entre dois envios para a mesma conversa
+	MaxAttempts  int
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+	flushMu  sync.Mutex
+	lastSend time.Time
+	lastChat map[string]time.Time
+	typing   map[int64]time.Time // Até quando cada mensagem fica em "digitando..."
+}
+
+var (
+	queuesMu sync.Mutex
+	queues   = make(map[string]*SendQueue)
+)
+
+// Limites do backoff entre tentativas
+var (
+	retryMinDelay = 2 * time.Second
+	retryMaxDelay = 5 * time.Minute
+)
+
+// StartSendQueue inicia a fila de envio da sessão. A partir daí todos os
+// envios do IClient da sessão passam pela fila. Configurável por
+// SEND_MIN_INTERVAL, SEND_CHAT_INTERVAL e SEND_MAX_ATTEMPTS.
+func StartSendQueue(wa QueueTransport, session *Session) *SendQueue {
+	q := &SendQueue{
+		WA:           wa,
+		Session:      session,
+		MinInterval:  session.Config.Queue.MinInterval,
+		ChatInterval: session.Config.Queue.ChatInterval,
+		MaxAttempts:  session.Config.Queue.MaxAttempts,
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+		lastChat:     make(map[string]time.Time),
+		typing:       make(map[int64]time.Time),
+	}
+
+	queuesMu.Lock()
+	queues[session.ID] = q
+	queuesMu.Unlock()
+
+	go q.run()
+	RegisterShutdownHook("fila de envio "+session.ID, q.Flush)
+	return q
+}
+
+// Obtém a fila de envio da sessão (nil se não iniciada)
+func getSendQueue(session *Session) *SendQueue {
+	if session == nil {
+		return nil
+	}
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	return queues[session.ID]
+}
+
+// Enqueue persiste a mensagem e acorda o worker. O fallback, se informado,
+// substitui a mensagem caso ela falhe de forma permanente.
+func (q *SendQueue) Enqueue(to types.JID, message *waE2E.Message, fallback *waE2E.Message, typing time.Duration, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+	var fallbackPayload []byte
+	if fallback != nil {
+		fallbackPayload, err = proto.Marshal(fallback)
+		if err != nil {
+			return whatsmeow.SendResponse{}, err
+		}
+	}
+
+	messageID := q.WA.GenerateMessageID()
+	if len(extra) > 0 && extra[0].ID != "" {
+		messageID = extra[0].ID
+	}
+
+	now := time.Now()
+	_, err = db.Exec(`
+	INSERT INTO outbound_messages (session_id, chat, message_id, payload, fallback, status, attempts, last_error, next_attempt_at, created_at, updated_at, sent_at, typing_ms)
+	VALUES (?, ?, ?, ?, ?, ?, 0, '', ?, ?, ?, 0, ?)`,
+		q.Session.ID, to.String(), messageID, payload, fallbackPayload, OutboundPending, now.Unix(), now.Unix(), now.Unix(), typing.Milliseconds(),
+	)
+	if err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return whatsmeow.SendResponse{ID: messageID, Timestamp: now}, nil
+}
+
+// Flush para o worker e tenta enviar o que está pronto na fila até o prazo do
+// contexto, sem esperar a digitação. O que sobrar continua persistido para o
+// próximo início. Pode ser chamado mais de uma vez.
+func (q *SendQueue) Flush(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.stop) })
+	<-q.stopped
+
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+
+	q.typing = make(map[int64]time.Time)
+
+	for {
+		if ctx.Err() != nil {
+			break
+		}
+		item, _, err := q.next()
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			break
+		}
+		q.pace(ctx, item.Chat)
+		q.deliver(ctx, item)
+	}
+
+	pending, err := CountOutbound(q.Session.ID, OutboundPending)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		q.log().Warn("Mensagens pendentes serão enviadas no próximo início", "pending", pending)
+	}
+	return nil
+}
+
+func (q *SendQueue) run() {
+	defer close(q.stopped)
+
+	for {
+		item, wait, err := q.next()
+		if err != nil {
+			q.log().Error("Erro ao ler a fila", "error", err)
+			wait = 5 * time.Second
+		}
+
+		if item != nil && !q.WA.IsConnected() {
+			// Sem conexão: aguarda sem consumir tentativas
+			item, wait = nil, 2*time.Second
+		}
+
+		if item == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-q.stop:
+				timer.Stop()
+				return
+			case <-q.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+
+		if q.startTyping(item) {
+			// A conversa fica digitando enquanto o worker atende as outras
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-q.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		q.pace(ctx, item.Chat)
+		if ctx.Err() == nil {
+			q.deliver(ctx, item)
+		}
+		cancel()
+	}
+}
+
+// Escolhe a próxima mensagem a enviar: a mais antiga pendente de cada
+// conversa (mantendo a ordem), desde que a conversa não esteja aguardando o
+// backoff, o intervalo mínimo ou a digitação. Sem mensagem pronta, retorna
+// quanto esperar.
+func (q *SendQueue) next() (*OutboundMessage, time.Duration, error) {
+	rows, err := db.Query(`
+	SELECT id, session_id, chat, message_id, payload, fallback, status, attempts, last_error, next_attempt_at, created_at, updated_at, sent_at, typing_ms
+	FROM outbound_messages
+	WHERE id IN (
+		SELECT MIN(id) FROM outbound_messages
+		WHERE session_id = ? AND status = ?
+		GROUP BY chat
+	)
+	ORDER BY id`, q.Session.ID, OutboundPending)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	wait := time.Minute
+	now := time.Now()
+	for rows.Next() {
+		item, err := scanOutbound(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		readyAt := time.Unix(item.NextAttemptAt, 0)
+		if last, ok := q.lastChat[item.Chat]; ok && last.Add(q.ChatInterval).After(readyAt) {
+			readyAt = last.Add(q.ChatInterval)
+		}
+		if until, ok := q.typing[item.ID]; ok && until.After(readyAt) {
+			readyAt = until
+		}
+		if !readyAt.After(now) {
+			return item, 0, nil
+		}
+		if until := readyAt.Sub(now); until < wait {
+			wait = until
+		}
+	}
+	return nil, wait, rows.Err()
+}
+
+// Aguarda o intervalo mínimo global e o da conversa
+func (q *SendQueue) pace(ctx context.Context, chat string) {
+	readyAt := q.lastSend.Add(q.MinInterval)
+	if last, ok := q.lastChat[chat]; ok && last.Add(q.ChatInterval).After(readyAt) {
+		readyAt = last.Add(q.ChatInterval)
+	}
+	if wait := time.Until(readyAt); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+}
+
+// Mostra "digitando..." na conversa da mensagem e agenda o envio para o fim da
+// digitação, sem bloquear o worker. Retorna false se a mensagem não digita ou
+// já digitou (novas tentativas não digitam de novo).
+func (q *SendQueue) startTyping(item *OutboundMessage) bool {
+	if item.TypingMs <= 0 || item.Attempts > 0 {
+		return false
+	}
+	if _, ok := q.typing[item.ID]; ok {
+		return false
+	}
+
+	until := time.Now().Add(time.Duration(item.TypingMs) * time.Millisecond)
+	to, err := types.ParseJID(item.Chat)
+	if err == nil {
+		err = q.WA.SendChatPresence(to, types.ChatPresenceComposing, types.ChatPresenceMediaText)
+	}
+	if err != nil {
+		q.log().Warn("Erro ao enviar presença", "chat", item.Chat, "error", err)
+		until = time.Now()
+	}
+	q.typing[item.ID] = until
+	return true
+}
+
+// Envia a mensagem e registra o resultado
+func (q *SendQueue) deliver(ctx context.Context, item *OutboundMessage) {
+	delete(q.typing, item.ID)
+
+	var message waE2E.Message
+	if err := proto.Unmarshal(item.payload, &message); err != nil {
+		q.fail(item, err)
+		return
+	}
+	to, err := types.ParseJID(item.Chat)
+	if err != nil {
+		q.fail(item, err)
+		return
+	}
+
+	_, err = q.WA.SendMessage(ctx, to, &message, whatsmeow.SendRequestExtra{ID: item.MessageID})
+	q.lastSend = time.Now()
+	q.lastChat[item.Chat] = q.lastSend
+
+	if err == nil {
+		q.update(item.ID, `status = ?, attempts = attempts + 1, last_error = '', sent_at = ?`, OutboundSent, time.Now().Unix())
+		q.complete(item, DeliverySent, "")
+		return
+	}
+
+	attempts := item.Attempts + 1
+	if !IsRetryableSendError(err) || attempts >= q.MaxAttempts {
+		q.fail(item, err)
+		return
+	}
+
+	delay := retryDelay(attempts)
+	q.log().Warn("Falha ao enviar, nova tentativa agendada", "message_id", item.MessageID, "attempt", attempts, "delay", delay.String(), "error", err)
+	q.update(item.ID, `attempts = ?, last_error = ?, next_attempt_at = ?`, attempts, err.Error(), time.Now().Add(delay).Unix())
+}
+
+// Espera antes da próxima tentativa: dobra a cada tentativa, de
+// retryMinDelay até retryMaxDelay
+func retryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := retryMinDelay << (attempts - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// Marca a mensagem como falha permanente, ou troca pelo fallback se existir
+func (q *SendQueue) fail(item *OutboundMessage, err error) {
+	if len(item.fallback) > 0 {
+		q.log().Warn("Mensagem falhou, enviando alternativa", "message_id", item.MessageID, "error", err)
+		q.update(item.ID, `payload = fallback, fallback = NULL, message_id = ?, attempts = 0, last_error = ?, next_attempt_at = 0`,
+			q.WA.GenerateMessageID(), err.Error())
+		return
+	}
+	q.log().Error("Mensagem descartada", "message_id", item.MessageID, "chat", item.Chat, "error", err)
+	q.update(item.ID, `status = ?, attempts = attempts + 1, last_error = ?`, OutboundFailed, err.Error())
+	q.complete(item, DeliveryFailed, err.Error())
+}
+
+// Registra o resultado final nos registros ligados à mensagem (entregas de
+// informe enfileiradas)
+func (q *SendQueue) complete(item *OutboundMessage, status string, detail string) {
+	if err := completeInformeDelivery(item.MessageID, status, detail); err != nil {
+		q.log().Error("Erro ao atualizar entrega de informe", "message_id", item.MessageID, "error", err)
+	}
+}
+
+func (q *SendQueue) log() *slog.Logger {
+	return helpers.Logger("fila").With("session", q.Session.ID)
+}
+
+func (q *SendQueue) update(id int64, set string, args ...interface{}) {
+	args = append(args, time.Now().Unix(), id)
+	_, err := db.Exec("UPDATE outbound_messages SET "+set+", updated_at = ? WHERE id = ?", args...)
+	if err != nil {
+		q.log().Error("Erro ao atualizar mensagem", "id", id, "error", err)
+	}
+}
+
+// IsRetryableSendError classifica os erros de envio: falhas de conexão,
+// timeouts, limite de taxa e erros 5xx do servidor são transitórios; o resto
+// (destinatário inválido, requisição recusada, erros desconhecidos...) é
+// permanente, para não repetir até SEND_MAX_ATTEMPTS um envio que não vai passar.
+func IsRetryableSendError(err error) bool {
+	var iqErr *whatsmeow.IQError
+	var disconnected *whatsmeow.DisconnectedError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, whatsmeow.ErrBroadcastListUnsupported),
+		errors.Is(err, whatsmeow.ErrUnknownServer),
+		errors.Is(err, whatsmeow.ErrRecipientADJID),
+		errors.Is(err, whatsmeow.ErrInvalidInlineBotID),
+		errors.Is(err, whatsmeow.ErrClientIsNil):
+		return false
+	case errors.Is(err, whatsmeow.ErrNotConnected),
+		errors.Is(err, whatsmeow.ErrNotLoggedIn),
+		errors.Is(err, whatsmeow.ErrIQTimedOut),
+		errors.Is(err, whatsmeow.ErrMessageTimedOut),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, context.Canceled),
+		errors.As(err, &disconnected),
+		errors.As(err, &netErr):
+		return true
+	case errors.As(err, &iqErr):
+		return iqErr.Code == 429 || iqErr.Code >= 500 || iqErr.Code == 0
+	}
+	return false
+}
+
+// Obtém o registro de uma mensagem da fila pelo ID da mensagem no WhatsApp
+func GetOutboundMessage(messageID string) (*OutboundMessage, error) {
+	rows, err := db.Query(`
+	SELECT id, session_id, chat, message_id, payload, fallback, status, attempts, last_error, next_attempt_at, created_at, updated_at, sent_at, typing_ms
+	FROM outbound_messages WHERE message_id = ?`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return scanOutbound(rows)
+}
+
+// Conta as mensagens da sessão com o status informado
+func CountOutbound(sessionID string, status string) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM outbound_messages WHERE session_id = ? AND status = ?", sessionID, status).Scan(&count)
+	return count, err
+}
+
+func scanOutbound(rows *sql.Rows) (*OutboundMessage, error) {
+	var item OutboundMessage
+	err := rows.Scan(&item.ID, &item.SessionID, &item.Chat, &item.MessageID, &item.payload, &item.fallback,
+		&item.Status, &item.Attempts, &item.LastError, &item.NextAttemptAt, &item.CreatedAt, &item.UpdatedAt, &item.SentAt, &item.TypingMs)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
@@ -0,0 +1,195 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestIsRetryableSendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"sem conexão", whatsmeow.ErrNotConnected, true},
+		{"sem login", whatsmeow.ErrNotLoggedIn, true},
+		{"timeout de IQ", whatsmeow.ErrIQTimedOut, true},
+		{"timeout da mensagem", whatsmeow.ErrMessageTimedOut, true},
+		{"timeout embrulhado", fmt.Errorf("envio: %w", whatsmeow.ErrMessageTimedOut), true},
+		{"prazo do contexto", context.DeadlineExceeded, true},
+		{"contexto cancelado", context.Canceled, true},
+		{"desconectado", &whatsmeow.DisconnectedError{Action: "send"}, true},
+		{"erro de rede", &net.OpError{Op: "write", Net: "tcp", Err: errors.New("broken pipe")}, true},
+		{"limite de taxa", &whatsmeow.IQError{Code: 429}, true},
+		{"erro do servidor", &whatsmeow.IQError{Code: 503}, true},
+		{"IQ sem código", &whatsmeow.IQError{}, true},
+		{"requisição recusada", &whatsmeow.IQError{Code: 400}, false},
+		{"não encontrado", &whatsmeow.IQError{Code: 404}, false},
+		{"lista de transmissão", whatsmeow.ErrBroadcastListUnsupported, false},
+		{"servidor desconhecido", whatsmeow.ErrUnknownServer, false},
+		{"destinatário AD", whatsmeow.ErrRecipientADJID, false},
+		{"cliente nil", whatsmeow.ErrClientIsNil, false},
+		{"erro desconhecido", errors.New("falha qualquer"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableSendError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableSendError(%v) = %v, esperado %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{8, 256 * time.Second},
+		{9, 5 * time.Minute},
+		{64, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, esperado %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// Fila da sessão de teste sobre o FakeTransport, sem intervalo entre envios
+func newTestQueue(t *testing.T) (*SendQueue, *FakeTransport) {
+	t.Helper()
+
+	conn, fake := newTestClient(t)
+	conn.Config.Queue.MinInterval = 0
+	conn.Config.Queue.ChatInterval = 0
+	q := StartSendQueue(fake, conn.Session)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		q.Flush(ctx)
+		queuesMu.Lock()
+		delete(queues, conn.Session.ID)
+		queuesMu.Unlock()
+	})
+	return q, fake
+}
+
+func enqueueText(t *testing.T, q *SendQueue, chat types.JID, text string) string {
+	t.Helper()
+
+	resp, err := q.Enqueue(chat, &waE2E.Message{Conversation: proto.String(text)}, nil, 0)
+	if err != nil {
+		t.Fatalf("Enqueue(%q): %v", text, err)
+	}
+	return resp.ID
+}
+
+// Espera até a condição ser verdadeira ou o prazo acabar
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("tempo esgotado esperando %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func outboundStatus(t *testing.T, messageID string) *OutboundMessage {
+	t.Helper()
+
+	item, err := GetOutboundMessage(messageID)
+	if err != nil || item == nil {
+		t.Fatalf("GetOutboundMessage(%s) = %v, %v", messageID, item, err)
+	}
+	return item
+}
+
+func TestSendQueueBacksOffWithoutBlockingOtherChats(t *testing.T) {
+	q, fake := newTestQueue(t)
+	fake.SendErrors = []error{whatsmeow.ErrIQTimedOut}
+
+	chatA := types.NewJID("5511999990001", types.DefaultUserServer)
+	chatB := types.NewJID("5511999990002", types.DefaultUserServer)
+	failedAt := time.Now()
+	first := enqueueText(t, q, chatA, "A1")
+	second := enqueueText(t, q, chatA, "A2")
+	enqueueText(t, q, chatB, "B1")
+
+	waitFor(t, "o envio para a outra conversa", func() bool { return len(fake.Texts()) == 1 })
+	if texts := fake.Texts(); texts[0] != "B1" {
+		t.Fatalf("enviado %v, esperado apenas B1 enquanto A1 aguarda a nova tentativa", texts)
+	}
+
+	item := outboundStatus(t, first)
+	if item.Status != OutboundPending || item.Attempts != 1 || item.LastError == "" {
+		t.Errorf("A1: status %s, %d tentativa(s), erro %q; esperado pendente após 1 tentativa com erro", item.Status, item.Attempts, item.LastError)
+	}
+	if earliest := failedAt.Add(retryMinDelay).Unix() - 1; item.NextAttemptAt < earliest {
+		t.Errorf("A1: nova tentativa em %d, esperado a partir de %d", item.NextAttemptAt, earliest)
+	}
+	if item := outboundStatus(t, second); item.Status != OutboundPending || item.Attempts != 0 {
+		t.Errorf("A2: status %s, %d tentativa(s); não deveria passar à frente de A1", item.Status, item.Attempts)
+	}
+}
+
+func TestSendQueueKeepsChatOrderAcrossRetries(t *testing.T) {
+	previous := retryMinDelay
+	retryMinDelay = time.Millisecond
+	t.Cleanup(func() { retryMinDelay = previous })
+
+	q, fake := newTestQueue(t)
+	fake.SendErrors = []error{whatsmeow.ErrNotConnected, whatsmeow.ErrIQTimedOut}
+
+	chat := types.NewJID("5511999990001", types.DefaultUserServer)
+	first := enqueueText(t, q, chat, "1")
+	enqueueText(t, q, chat, "2")
+	enqueueText(t, q, chat, "3")
+
+	waitFor(t, "os três envios", func() bool { return len(fake.Texts()) == 3 })
+	texts := fake.Texts()
+	if texts[0] != "1" || texts[1] != "2" || texts[2] != "3" {
+		t.Errorf("ordem de envio %v, esperado [1 2 3]", texts)
+	}
+	if item := outboundStatus(t, first); item.Status != OutboundSent || item.Attempts != 3 {
+		t.Errorf("1: status %s após %d tentativa(s), esperado enviado após 3", item.Status, item.Attempts)
+	}
+}
+
+func TestSendQueueFailsPermanentErrors(t *testing.T) {
+	q, fake := newTestQueue(t)
+	fake.SendErrors = []error{whatsmeow.ErrRecipientADJID}
+
+	chat := types.NewJID("5511999990001", types.DefaultUserServer)
+	id := enqueueText(t, q, chat, "1")
+
+	waitFor(t, "a falha permanente", func() bool { return outboundStatus(t, id).Status == OutboundFailed })
+	if item := outboundStatus(t, id); item.Attempts != 1 {
+		t.Errorf("%d tentativa(s), erro permanente não deveria ser repetido", item.Attempts)
+	}
+}
+
+func TestSendQueueFlushTwice(t *testing.T) {
+	q, _ := newTestQueue(t)
+
+	for i := 0; i < 2; i++ {
+		if err := q.Flush(context.Background()); err != nil {
+			t.Fatalf("Flush #%d: %v", i+1, err)
+		}
+	}
+}
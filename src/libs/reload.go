@@ -0,0 +1,76 @@
+package libs
+
+import (
+	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Serializa as recargas (SIGHUP, comando de owner e API podem chegar juntos)
+var reloadMu sync.Mutex
+
+// Resultado de uma recarga bem-sucedida
+type ReloadResult struct {
+	Locales  []string
+	Duration time.Duration
+}
+
+// Reload recarrega o catálogo de templates (embutido ou TEMPLATES_DIR) sem
+// reiniciar as sessões. Os stages são código Go compilado no binário e não
+// mudam: o novo catálogo é validado contra os stages em uso antes de
+// substituir o atual; se a validação falhar, nada muda. Handlers em andamento
+// terminam com o catálogo que já obtiveram.
+func Reload(cfg *config.Config) (*ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	started := time.Now()
+	loaded, err := loadCatalog(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+
+	var problems []string
+	for _, problem := range templateProblems(loaded, currentStages()) {
+		if problem.Locale == loaded.defaultLocale {
+			problems = append(problems, fmt.Sprintf("%s (%s): %s", problem.Name, problem.Source, problem.Err.Error()))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("recarga recusada:\n%s", strings.Join(problems, "\n"))
+	}
+
+	catalogMu.Lock()
+	catalog = loaded
+	catalogMu.Unlock()
+
+	result := &ReloadResult{Locales: Locales(), Duration: time.Since(started)}
+	helpers.Logger("reload").Info("Templates recarregados",
+		"locales", strings.Join(result.Locales, ", "), "duration", result.Duration.Round(time.Millisecond).String())
+	return result, nil
+}
+
+// Comando de owner para recarregar os textos: "/reload" ou "/recarregar"
+func handleReloadCommand(conn *IClient, m *IMessage) bool {
+	command := strings.ToLower(strings.TrimSpace(m.Text))
+	if command != "/reload" && command != "/recarregar" {
+		return false
+	}
+	if !m.IsOwner {
+		return false
+	}
+
+	result, err := Reload(conn.Config)
+	if err != nil {
+		m.Log.Error("Recarga recusada", "component", "reload", "error", err)
+		m.Reply(conn.Render(m, "recarga_erro", map[string]interface{}{"Erro": err.Error()}))
+		return true
+	}
+	m.Reply(conn.Render(m, "recarga_ok", map[string]interface{}{
+		"Idiomas": strings.Join(result.Locales, ", "),
+	}))
+	return true
+}
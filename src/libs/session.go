@@ -0,0 +1,113 @@
+package libs
+
+import (
+	"database/sql"
+	"hisoka/src/config"
+	"regexp"
+)
+
+// ID da sessão usada quando SESSIONS não está configurado
+const DefaultSessionID = config.DefaultSessionID
+
+// Session descreve uma linha de atendimento: um número de WhatsApp com seu
+// próprio pareamento, fluxo (stage raiz), owners e regras de acesso
+type Session struct {
+	ID            string
+	RootStage     string
+	Owners        []string
+	AllowedUsers  []string // Vazio = qualquer usuário pode ser atendido
+	PairingNumber string
+
+	Config *config.Config // Configuração do processo que atende a sessão
+}
+
+var sessions []*Session
+
+var nonDigits = regexp.MustCompile(`\D+`)
+
+// LoadSessions carrega as sessões da configuração (ver config.SessionConfig)
+func LoadSessions(cfg *config.Config) ([]*Session, error) {
+	sessions = nil
+	for _, session := range cfg.Sessions {
+		sessions = append(sessions, &Session{
+			ID:            session.ID,
+			RootStage:     session.RootStage,
+			Owners:        append([]string(nil), session.Owners...),
+			AllowedUsers:  append([]string(nil), session.AllowedUsers...),
+			PairingNumber: session.PairingNumber,
+			Config:        cfg,
+		})
+	}
+	return sessions, nil
+}
+
+// Obtém todas as sessões carregadas
+func GetSessions() []*Session {
+	return sessions
+}
+
+// Obtém uma sessão por ID
+func GetSession(id string) *Session {
+	for _, session := range sessions {
+		if session.ID == id {
+			return session
+		}
+	}
+	return nil
+}
+
+// Sessão usada para dados anteriores ao suporte a várias sessões
+func DefaultSession() *Session {
+	if len(sessions) == 0 {
+		return &Session{ID: DefaultSessionID, RootStage: "default", Config: config.Default()}
+	}
+	return sessions[0]
+}
+
+// Verifica se o usuário é owner desta sessão
+func (s *Session) IsOwner(userID string) bool {
+	for _, owner := range s.Owners {
+		if owner == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifica se o usuário pode ser atendido por esta sessão
+func (s *Session) IsAuthorized(userID string) bool {
+	if len(s.AllowedUsers) == 0 {
+		return true
+	}
+	for _, allowed := range s.AllowedUsers {
+		if allowed == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Obtém o JID do dispositivo vinculado à sessão ("" se ainda não pareada)
+func GetSessionDevice(sessionID string) (string, error) {
+	var jid string
+	err := db.QueryRow("SELECT device_jid FROM bot_sessions WHERE session_id = ?", sessionID).Scan(&jid)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return jid, err
+}
+
+// Vincula o dispositivo pareado à sessão
+func SaveSessionDevice(sessionID string, jid string) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO bot_sessions (session_id, device_jid) VALUES (?, ?)",
+		sessionID, jid,
+	)
+	return err
+}
+
+// Remove o vínculo da sessão com o dispositivo (após logout)
+func DeleteSessionDevice(sessionID string) error {
+	_, err := db.Exec("DELETE FROM bot_sessions WHERE session_id = ?", sessionID)
+	return err
+}
@@ -2,28 +2,79 @@ package libs
 
 import (
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var stages map[string]*Stage
+// Registro de stages. Os stages são código Go: são registrados na
+// inicialização (init() dos pacotes em src/stages e InitStages) e não mudam
+// com o bot em execução; a recarga (Reload) troca apenas os textos.
+var (
+	registryMu sync.RWMutex
+	stages     = make(map[string]*Stage)
+)
 var db *sql.DB
 
-// Inicializa o sistema de stages
-func InitStages() error {
-	stages = make(map[string]*Stage)
+// Inicializa o sistema de stages (banco, migrações e store do estado) com a
+// configuração informada
+func InitStages(cfg *config.Config) error {
+	err := OpenStagesDB(cfg)
+	if err != nil {
+		return err
+	}
+	
+	// Aplica as migrações pendentes (migrations/*.sql); recusa bancos com
+	// esquema mais novo que o deste binário
+	err = Migrate()
+	if err != nil {
+		return err
+	}
+	
+	// Store do estado dos usuários (STATE_STORE)
+	store, err := NewStateStoreFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if previous := GetStateStore(); previous != nil {
+		previous.Close()
+	}
+	SetStateStore(store)
 	
-	// Obter diretório de dados das variáveis de ambiente
-	dataDir := os.Getenv("DATA_DIR")
-	if dataDir == "" {
-		dataDir = "."
+	// Registra os stages básicos (registrar de novo o mesmo stage apenas o
+	// substitui)
+	registerBasicStages()
+	
+	return nil
+}
+
+// OpenStagesDB abre o stages.db em DATA_DIR, sem aplicar migrações. Com
+// STATE_STORE=memory o banco também fica em memória: nada é gravado em disco
+// e tudo se perde ao encerrar (testes e simulações).
+func OpenStagesDB(cfg *config.Config) error {
+	if cfg.StateStore == "memory" {
+		var err error
+		db, err = sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+		if err != nil {
+			return err
+		}
+		// Cada conexão teria o próprio banco em memória
+		db.SetMaxOpenConns(1)
+		return nil
 	}
 	
+	dataDir := cfg.DataDir
+	
 	// Criar diretório se não existir
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return err
@@ -31,32 +82,79 @@ func InitStages() error {
 	
 	dbPath := dataDir + "/stages.db"
 	
-	// Conecta ao banco de dados
+	// Conecta ao banco de dados. Os comandos da CLI (users reset, migrate up,
+	// tickets list, db backup) rodam ao lado do bot: WAL permite ler durante
+	// as escritas e o busy_timeout espera o lock em vez de falhar com
+	// "database is locked"
 	var err error
-	db, err = sql.Open("sqlite3", "file:"+dbPath+"?_foreign_keys=on")
-	if err != nil {
+	db, err = sql.Open("sqlite3", "file:"+dbPath+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL")
+	return err
+}
+
+// Converte a tabela user_stages antiga (chave apenas user_id) para a chave
+// (session_id, user_id), atribuindo os usuários existentes à sessão padrão
+func upgradeUserStagesTable() error {
+	exists, err := hasColumn("user_stages", "user_id")
+	if err != nil || !exists {
+		return err
+	}
+	upgraded, err := hasColumn("user_stages", "session_id")
+	if err != nil || upgraded {
 		return err
 	}
 	
-	// Cria a tabela de usuários se não existir
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS user_stages (
-		user_id TEXT PRIMARY KEY,
-		current_stage TEXT NOT NULL,
-		data TEXT,
-		created_at INTEGER NOT NULL,
-		updated_at INTEGER NOT NULL
-	);`
-	
-	_, err = db.Exec(createTableSQL)
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+	
+	statements := []string{
+		`ALTER TABLE user_stages RENAME TO user_stages_legacy`,
+		`CREATE TABLE user_stages (
+			session_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			current_stage TEXT NOT NULL,
+			data TEXT,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (session_id, user_id)
+		)`,
+		`INSERT INTO user_stages (session_id, user_id, current_stage, data, created_at, updated_at)
+			SELECT ?, user_id, current_stage, data, created_at, updated_at FROM user_stages_legacy`,
+		`DROP TABLE user_stages_legacy`,
+	}
+	for i, statement := range statements {
+		if i == 2 {
+			_, err = tx.Exec(statement, DefaultSession().ID)
+		} else {
+			_, err = tx.Exec(statement)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Verifica se a tabela possui a coluna (false se a tabela não existe)
+func hasColumn(table string, column string) (bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
 	
-	// Registra stages básicos se não foram registrados automaticamente
-	registerBasicStages()
-	
-	return nil
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
 // Registra stages básicos manualmente se necessário
@@ -67,14 +165,26 @@ func registerBasicStages() {
 		Name:        "Menu Principal",
 		Description: "Menu principal de atendimento",
 		Handler:     defaultHandler,
-		NextStages:  []string{
-			"adesao", "aplicativo", "capital", "emprestimos", 
-			"parcerias", "consultoria", "excolaborador", 
-			"negociacao", "informe", "duvidas",
-		},
+		Templates:   []string{"menu", "encerrado", "erro_acesso"},
+		// Capital, parcerias, consultoria, ex-colaborador e negociação não têm
+		// fluxo próprio: são encaminhados ao atendimento humano (duvidas)
+		NextStages:  []string{"adesao", "aplicativo", "emprestimos", "informe", "duvidas"},
 		IsOwner:     false,
 		IsGroup:     false,
 		IsPrivate:   false,
+		Options: []StageOption{
+			{ID: "1", Title: "Adesão", Description: "Informações sobre adesão"},
+			{ID: "2", Title: "Aplicativo ou Senha", Description: "Acesso ao sistema"},
+			{ID: "3", Title: "Capital (Investimento)", Description: "Produtos de investimento"},
+			{ID: "4", Title: "Empréstimos", Description: "Soluções de crédito"},
+			{ID: "5", Title: "Parcerias", Description: "Oportunidades de parceria"},
+			{ID: "6", Title: "Consultoria Financeira", Description: "Orientação especializada"},
+			{ID: "7", Title: "Ex-colaborador", Description: "Atendimento para ex-funcionários"},
+			{ID: "8", Title: "Negociação de Dívidas", Description: "Ex-colaborador"},
+			{ID: "9", Title: "Informe de Rendimentos", Description: "Documentos fiscais"},
+			{ID: "10", Title: "Não encontrou?", Description: "Atendimento personalizado"},
+			{ID: "11", Title: "Encerrar Atendimento", Description: "Finalizar conversa"},
+		},
 	})
 	
 	// Registra o stage de adesão
@@ -83,10 +193,15 @@ func registerBasicStages() {
 		Name:        "Adesão",
 		Description: "Processo de adesão à Ativa Grupo SBF",
 		Handler:     adesaoHandler,
+		Templates:   []string{"adesao", "adesao_link", "erro_voltar"},
 		NextStages:  []string{"default"},
 		IsOwner:     false,
 		IsGroup:     false,
 		IsPrivate:   false,
+		Options: []StageOption{
+			{ID: "link", Title: "Link do formulário", Description: "Formulário de Pessoa Física"},
+			{ID: "0", Title: "Menu principal", Description: "Voltar ao menu principal"},
+		},
 	})
 	
 	// Registra o stage de aplicativo/senha
@@ -95,557 +210,464 @@ func registerBasicStages() {
 		Name:        "Aplicativo ou Senha",
 		Description: "Ajuda com aplicativo e senhas de acesso",
 		Handler:     aplicativoHandler,
+		Templates:   []string{
+			"aplicativo", "aplicativo_download", "aplicativo_senha",
+			"aplicativo_bloqueada", "aplicativo_bloqueada_sim", "aplicativo_bloqueada_nao",
+			"encerrado", "erro_voltar", "midia_recebida",
+		},
+		// Aceita o print da tela com o erro de acesso
+		Media: &MediaPolicy{
+			Accept:    []string{MediaImage, MediaDocument},
+			MimeTypes: []string{"image/jpeg", "image/png", "image/webp", "application/pdf"},
+		},
 		NextStages:  []string{"default"},
 		IsOwner:     false,
 		IsGroup:     false,
 		IsPrivate:   false,
+		Options: []StageOption{
+			{ID: "1", Title: "Baixar o aplicativo", Description: "Como baixar o aplicativo"},
+			{ID: "2", Title: "Esqueci minha senha", Description: "Recuperar a senha de acesso ao aplicativo"},
+			{ID: "3", Title: "Senha bloqueada", Description: "Recebi a mensagem de senha bloqueada"},
+			{ID: "4", Title: "Menu inicial", Description: "Voltar ao menu inicial"},
+			{ID: "5", Title: "Encerrar atendimento", Description: "Finalizar conversa"},
+		},
 	})
+	
+	// Registra o stage de informe de rendimentos
+	registerInformeStage()
+	
+	// Registra o stage de simulação de empréstimos
+	registerEmprestimosStage()
+	
+	// Registra o stage de atendimento humano
+	registerAtendimentoStage()
 }
 
 // Handler do stage default
 func defaultHandler(conn *IClient, m *IMessage, userStage *UserStage) bool {
-	// Teste simples primeiro
-	fmt.Println("🚀 [DEFAULT] TESTE - Handler INICIADO!")
-	fmt.Printf("🚀 [DEFAULT] Handler INICIADO para usuário %s\n", m.Sender.ToNonAD().User)
-	fmt.Printf("🚀 [DEFAULT] Parâmetros: conn=%v, m=%v, userStage=%v\n", conn != nil, m != nil, userStage != nil)
+	log := m.Log.With("stage", "default")
 	
 	text := strings.ToLower(strings.TrimSpace(m.Text))
-	fmt.Printf("🔍 [DEFAULT] Handler recebeu: '%s' do usuário %s\n", text, m.Sender.ToNonAD().User)
+	log.Debug("Handler recebeu", "length", len(text))
 	
 	switch text {
 	case "1", "adesão", "adesao":
-		fmt.Printf("🔄 [DEFAULT] Usuário quer ir para adesão\n")
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "adesao")
+		log.Debug("Usuário quer ir para adesão")
+		err := ChangeUserStage(conn.Session.ID, m.Sender.ToNonAD().User, "adesao")
 		if err != nil {
-			fmt.Printf("❌ [DEFAULT] Erro ao mudar stage: %s\n", err.Error())
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+			log.Error("Erro ao mudar stage", "error", err)
+			m.Reply(conn.Render(m, "erro_acesso", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
-		fmt.Printf("✅ [DEFAULT] Stage mudado para 'adesao'\n")
+		log.Debug("Stage mudado para adesao")
 		adesaoStage := GetStage("adesao")
 		if adesaoStage != nil && adesaoStage.Handler != nil {
-			fmt.Printf("🔄 [DEFAULT] Executando handler do stage adesao\n")
-			userStage, _ := GetUserStage(m.Sender.ToNonAD().User)
+			log.Debug("Executando handler do stage adesao")
+			userStage, _ := GetUserStage(conn.Session.ID, m.Sender.ToNonAD().User)
 			adesaoStage.Handler(conn, m, userStage)
-			fmt.Printf("✅ [DEFAULT] Handler do adesao executado\n")
+			log.Debug("Handler do adesao executado")
 		} else {
-			fmt.Printf("❌ [DEFAULT] Stage adesao não encontrado ou sem handler\n")
+			log.Error("Stage adesao não encontrado ou sem handler")
 		}
 		return true
 		
 	case "2", "aplicativo", "senha", "acesso":
 		// Navega para stage de aplicativo/senha e executa o handler imediatamente
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "aplicativo")
+		err := ChangeUserStage(conn.Session.ID, m.Sender.ToNonAD().User, "aplicativo")
 		if err != nil {
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+			m.Reply(conn.Render(m, "erro_acesso", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
 		aplicativoStage := GetStage("aplicativo")
 		if aplicativoStage != nil && aplicativoStage.Handler != nil {
-			fmt.Printf("🔄 [DEFAULT] Executando handler do stage aplicativo\n")
-			userStage, _ := GetUserStage(m.Sender.ToNonAD().User)
+			log.Debug("Executando handler do stage aplicativo")
+			userStage, _ := GetUserStage(conn.Session.ID, m.Sender.ToNonAD().User)
 			aplicativoStage.Handler(conn, m, userStage)
-			fmt.Printf("✅ [DEFAULT] Handler do aplicativo executado\n")
+			log.Debug("Handler do aplicativo executado")
 		}
 		return true
 
 	case "3", "capital", "investimento":
-		// Navega para stage de capital
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "capital")
-		if err != nil {
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+		// Sem fluxo próprio: atendimento humano com o assunto escolhido
+		if err := startHandoff(conn, m, "Capital (Investimento)"); err != nil {
+			m.Reply(conn.Render(m, "erro_acesso", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
 		return true
 
 	case "4", "empréstimos", "emprestimos":
-		// Navega para stage de empréstimos
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "emprestimos")
+		// Navega para stage de empréstimos e lista as linhas de crédito
+		err := ChangeUserStageWithMessage(conn.Session.ID, m.Sender.ToNonAD().User, "emprestimos", conn, m)
 		if err != nil {
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+			replyStageError(conn, m, err)
 			return false
 		}
 		return true
 
 	case "5", "parcerias":
-		// Navega para stage de parcerias
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "parcerias")
-		if err != nil {
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+		// Sem fluxo próprio: atendimento humano com o assunto escolhido
+		if err := startHandoff(conn, m, "Parcerias"); err != nil {
+			m.Reply(conn.Render(m, "erro_acesso", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
 		return true
 
 	case "6", "consultoria", "financeira":
-		// Navega para stage de consultoria
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "consultoria")
-		if err != nil {
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+		// Sem fluxo próprio: atendimento humano com o assunto escolhido
+		if err := startHandoff(conn, m, "Consultoria Financeira"); err != nil {
+			m.Reply(conn.Render(m, "erro_acesso", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
 		return true
 
 	case "7", "ex-colaborador", "excolaborador":
-		// Navega para stage de ex-colaborador
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "excolaborador")
-		if err != nil {
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+		// Sem fluxo próprio: atendimento humano com o assunto escolhido
+		if err := startHandoff(conn, m, "Ex-colaborador"); err != nil {
+			m.Reply(conn.Render(m, "erro_acesso", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
 		return true
 
 	case "8", "negociação", "negociacao", "dívidas", "dividas":
-		// Navega para stage de negociação de dívidas
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "negociacao")
-		if err != nil {
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+		// Sem fluxo próprio: atendimento humano com o assunto escolhido
+		if err := startHandoff(conn, m, "Negociação de Dívidas"); err != nil {
+			m.Reply(conn.Render(m, "erro_acesso", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
 		return true
 
 	case "9", "informe", "rendimentos":
-		// Navega para stage de informe de rendimentos
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "informe")
+		// Navega para stage de informe de rendimentos e inicia a verificação
+		err := ChangeUserStageWithMessage(conn.Session.ID, m.Sender.ToNonAD().User, "informe", conn, m)
 		if err != nil {
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+			replyStageError(conn, m, err)
 			return false
 		}
 		return true
 
 	case "10", "dúvida", "duvida", "não encontrou", "nao encontrou":
-		// Navega para stage de dúvidas
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "duvidas")
-		if err != nil {
-			m.Reply("❌ Erro ao acessar: " + err.Error())
+		// Navega para o atendimento humano e pede a descrição da dúvida
+		if err := startHandoff(conn, m, ""); err != nil {
+			m.Reply(conn.Render(m, "erro_acesso", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
 		return true
 
 	case "11", "encerrar", "sair", "fim":
 		// Encerra o atendimento
-		m.Reply(`👋 *Atendimento encerrado!*
-
-Obrigado por entrar em contato conosco.
-
-Se precisar de mais alguma coisa, é só me chamar novamente! 😊`)
+		m.Reply(conn.Render(m, "encerrado", nil))
 		return true
 
 	default:
-		fmt.Printf("🔄 [DEFAULT] Enviando mensagem padrão do menu\n")
+		log.Debug("Enviando mensagem padrão do menu")
 		// Mostra o menu principal
-		message := fmt.Sprintf(`🏢 *Olá! Bem-vindo ao Whatsapp da Ativa Grupo SBF 😃*
-
-Olá, %s! 👋
-Informamos que as mensagens deste canal devem ser apenas de texto. Não atendemos mensagens de voz ou ligações.
-
-Escolha a opção desejada para atendimento:
-
-📋 *MENU PRINCIPAL*
-
-1️⃣ *Adesão* - Informações sobre adesão
-2️⃣ *Aplicativo ou Senha* - Acesso ao sistema
-3️⃣ *Capital (Investimento)* - Produtos de investimento
-4️⃣ *Empréstimos* - Soluções de crédito
-5️⃣ *Parcerias* - Oportunidades de parceria
-6️⃣ *Consultoria Financeira* - Orientação especializada
-7️⃣ *Ex-colaborador* - Atendimento para ex-funcionários
-8️⃣ *Negociação de Dívidas* - Ex-colaborador
-9️⃣ *Informe de Rendimentos* - Documentos fiscais
-🔟 *Não encontrou sua dúvida?* - Atendimento personalizado
-1️⃣1️⃣ *Encerrar Atendimento* - Finalizar conversa
-
-💡 *Como usar:*
-• Digite o *número* da opção (ex: 1, 2, 3...)
-• Digite o *nome* da opção (ex: adesão, empréstimos)
-• Use palavras-chave como *sair* ou *encerrar*
-
-Escolha uma opção para continuar! ⬇️`, m.Info.PushName)
+		message := conn.Render(m, "menu", nil)
 		
-		m.Reply(message)
+		m.ReplyMenu(GetStage("default"), message)
 		return true
 	}
-	
-	fmt.Printf("⚠️ [DEFAULT] Nenhum caso foi executado para: '%s'\n", text)
-	return false
 }
 
 // Handler do stage de adesão
 func adesaoHandler(conn *IClient, m *IMessage, userStage *UserStage) bool {
-	fmt.Printf("🚀 [ADESAO] Handler INICIADO para usuário %s\n", m.Sender.ToNonAD().User)
-	fmt.Printf("🚀 [ADESAO] Parâmetros: conn=%v, m=%v, userStage=%v\n", conn != nil, m != nil, userStage != nil)
+	log := m.Log.With("stage", "adesao")
 	
 	text := strings.ToLower(strings.TrimSpace(m.Text))
 	
-	fmt.Printf("🔍 [ADESAO] Handler recebeu: '%s' do usuário %s\n", text, m.Sender.ToNonAD().User)
-	fmt.Printf("🔍 [ADESAO] Texto processado: '%s'\n", text)
+	log.Debug("Handler recebeu", "length", len(text))
 	
 	switch text {
 	case "0", "voltar", "menu", "início", "inicio":
-		fmt.Printf("🔄 [ADESAO] Usuário quer voltar ao menu principal\n")
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "default")
+		log.Debug("Usuário quer voltar ao menu principal")
+		err := ChangeUserStage(conn.Session.ID, m.Sender.ToNonAD().User, conn.Session.RootStage)
 		if err != nil {
-			fmt.Printf("❌ [ADESAO] Erro ao mudar stage: %s\n", err.Error())
-			m.Reply("❌ Erro ao voltar: " + err.Error())
+			log.Error("Erro ao mudar stage", "error", err)
+			m.Reply(conn.Render(m, "erro_voltar", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
-		fmt.Printf("✅ [ADESAO] Stage mudado para 'default'\n")
-		defaultStage := GetStage("default")
+		log.Debug("Stage mudado para default")
+		defaultStage := GetStage(conn.Session.RootStage)
 		if defaultStage != nil && defaultStage.Handler != nil {
-			fmt.Printf("🔄 [ADESAO] Executando handler do stage default\n")
-			userStage, _ := GetUserStage(m.Sender.ToNonAD().User)
+			log.Debug("Executando handler do stage default")
+			userStage, _ := GetUserStage(conn.Session.ID, m.Sender.ToNonAD().User)
 			defaultStage.Handler(conn, m, userStage)
-			fmt.Printf("✅ [ADESAO] Handler do default executado\n")
+			log.Debug("Handler do default executado")
 		} else {
-			fmt.Printf("❌ [ADESAO] Stage default não encontrado ou sem handler\n")
+			log.Error("Stage default não encontrado ou sem handler")
 		}
 		return true
 		
 	case "link", "acessar", "formulário", "formulario":
 		// Mostra o link de acesso
-		message := `🔗 *Link para Adesão*
-
-Para acessar o formulário de adesão, clique no link abaixo:
-
-📋 *Formulário de Pessoa Física:*
-https://wscredcoopsbf.facilinformatica.com.br/facweb/#formulario-de-pessoa-fisica
-
-💡 *Dica:* Você pode copiar e colar o link no seu navegador.
-
-Digite *0* para voltar ao menu principal.`
+		message := conn.Render(m, "adesao_link", nil)
 		
 		m.Reply(message)
 		return true
 		
 	default:
-		fmt.Printf("🔄 [ADESAO] Enviando mensagem padrão de adesão\n")
+		log.Debug("Enviando mensagem padrão de adesão")
 		// Mostra as instruções de adesão
-		message := `📋 *PROCESSO DE ADESÃO - ATIVA GRUPO SBF*
-
-Para aderir à Ativa, siga os passos abaixo:
-
-🔗 *1. Acesse o Link*
-Para aderir à Ativa, acesse o link:
-https://wscredcoopsbf.facilinformatica.com.br/facweb/#formulario-de-pessoa-fisica
-
-📝 *2. Preencha o Formulário*
-Em seguida, preencha os campos obrigatórios marcados com asterisco vermelho (*).
-
-💾 *3. Salve os Dados*
-Após inserir todos os dados necessários, clique em "SALVAR"
-
-📄 *4. Termo de Consentimento*
-Aparecerá na tela o Termo de Consentimento de Alteração de Dados Cadastrais. Leia atentamente e dê o aceite para prosseguir.
-
-✅ *5. Confirmação*
-Agora é só aguardar que o nosso time irá enviar um e-mail de boas-vindas e confirmação do cadastro.
-
-💡 *Comandos disponíveis:*
-• Digite *link* para acessar o formulário
-• Digite *0* para voltar ao menu principal
-
-Precisa de mais alguma informação sobre o processo de adesão?`
+		message := conn.Render(m, "adesao", nil)
 		
-		m.Reply(message)
+		m.ReplyMenu(GetStage("adesao"), message)
 		return true
 	}
-	
-	fmt.Printf("⚠️ [ADESAO] Nenhum caso foi executado para: '%s'\n", text)
-	return false
 }
 
 // Handler do stage de aplicativo/senha
 func aplicativoHandler(conn *IClient, m *IMessage, userStage *UserStage) bool {
-	fmt.Printf("🚀 [APLICATIVO] Handler INICIADO para usuário %s\n", m.Sender.ToNonAD().User)
-	fmt.Printf("🚀 [APLICATIVO] Parâmetros: conn=%v, m=%v, userStage=%v\n", conn != nil, m != nil, userStage != nil)
+	log := m.Log.With("stage", "aplicativo")
 	
 	text := strings.ToLower(strings.TrimSpace(m.Text))
 	
-	fmt.Printf("🔍 [APLICATIVO] Handler recebeu: '%s' do usuário %s\n", text, m.Sender.ToNonAD().User)
-	fmt.Printf("🔍 [APLICATIVO] Texto processado: '%s'\n", text)
+	log.Debug("Handler recebeu", "length", len(text))
+	
+	// Print da tela com o erro, já guardado no media store
+	if m.Attachment != nil {
+		log.Info("Usuário enviou mídia", "kind", m.Attachment.Kind, "media_id", m.Attachment.ID)
+		m.Reply(conn.Render(m, "midia_recebida", nil))
+		return true
+	}
 	
 	switch text {
 	case "0", "voltar", "menu", "início", "inicio":
-		fmt.Printf("🔄 [APLICATIVO] Usuário quer voltar ao menu principal\n")
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "default")
+		log.Debug("Usuário quer voltar ao menu principal")
+		err := ChangeUserStage(conn.Session.ID, m.Sender.ToNonAD().User, conn.Session.RootStage)
 		if err != nil {
-			fmt.Printf("❌ [APLICATIVO] Erro ao mudar stage: %s\n", err.Error())
-			m.Reply("❌ Erro ao voltar: " + err.Error())
+			log.Error("Erro ao mudar stage", "error", err)
+			m.Reply(conn.Render(m, "erro_voltar", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
-		fmt.Printf("✅ [APLICATIVO] Stage mudado para 'default'\n")
-		defaultStage := GetStage("default")
+		log.Debug("Stage mudado para default")
+		defaultStage := GetStage(conn.Session.RootStage)
 		if defaultStage != nil && defaultStage.Handler != nil {
-			fmt.Printf("🔄 [APLICATIVO] Executando handler do stage default\n")
-			userStage, _ := GetUserStage(m.Sender.ToNonAD().User)
+			log.Debug("Executando handler do stage default")
+			userStage, _ := GetUserStage(conn.Session.ID, m.Sender.ToNonAD().User)
 			defaultStage.Handler(conn, m, userStage)
-			fmt.Printf("✅ [APLICATIVO] Handler do default executado\n")
+			log.Debug("Handler do default executado")
 		} else {
-			fmt.Printf("❌ [APLICATIVO] Stage default não encontrado ou sem handler\n")
+			log.Error("Stage default não encontrado ou sem handler")
 		}
 		return true
 		
 	case "1", "baixar", "download", "aplicativo":
-		fmt.Printf("🔄 [APLICATIVO] Usuário quer saber como baixar o aplicativo\n")
-		message := `📱 *Como baixar o aplicativo*
-
-Você pode encontrar o nosso aplicativo pesquisando por "Cooper Ativa" em iOS ou Android.
-
-🔍 *Como encontrar:*
-• **iOS (App Store):** Procure por "Cooper Ativa"
-• **Android (Google Play):** Procure por "Cooper Ativa"
-
-💡 *Dica:* Certifique-se de baixar o aplicativo oficial da Cooperativa Ativa.
-
-📋 *Navegação:*
-• Digite *0* para voltar ao menu principal
-• Digite *5* para encerrar atendimento`
+		log.Debug("Usuário quer saber como baixar o aplicativo")
+		message := conn.Render(m, "aplicativo_download", nil)
 		
 		m.Reply(message)
 		return true
 		
 	case "2", "esqueci", "senha", "recuperar":
-		fmt.Printf("🔄 [APLICATIVO] Usuário quer recuperar senha\n")
-		message := `🔑 *Esqueci minha senha de acesso ao aplicativo*
-
-*Siga os passos abaixo:*
-
-1️⃣ **Acesse o iBanking através deste link:**
-https://wscredcoopsbf.facilinformatica.com.br/facweb/
-
-2️⃣ **Informe seu CPF e clique no botão "próxima".**
-
-3️⃣ **Clique no botão "esqueceu a senha?"**
-
-4️⃣ **Digite o CPF e a data de nascimento e clique botão "enviar"**
-
-5️⃣ **Você receberá uma senha temporária no e-mail cadastrado na Ativa**
-
-6️⃣ **Após o recebimento, entre no site ou app da Cooper Ativa novamente, repita o passo 1 e entre utilizando a sua senha temporária**
-
-7️⃣ **Após entrar, será necessário criar a sua senha definitiva. Para isso, insira sua senha temporária em "Senha atual", e crie a sua nova senha de 6 dígitos nos demais campos**
-
-8️⃣ **Uma vez confirmada a nova senha definitiva, clique em "ALTERAR SENHA"**
-
-9️⃣ **Para finalizar, aceite o termo de Consentimento para Tratamento de Dados para continuar.**
-
-📋 *Navegação:*
-• Digite *0* para voltar ao menu principal
-• Digite *5* para encerrar atendimento`
+		log.Debug("Usuário quer recuperar senha")
+		message := conn.Render(m, "aplicativo_senha", nil)
 		
 		m.Reply(message)
 		return true
 		
 	case "3", "bloqueada", "bloqueado":
-		fmt.Printf("🔄 [APLICATIVO] Usuário tem senha bloqueada\n")
-		message := `🔒 *Senha bloqueada*
-
-Você tentou realizar o acesso via iBanking ou pelo aplicativo "Cooper Ativa" e recebeu a mensagem que sua senha estava bloqueada? 🔒
-
-**Opções:**
-• Digite *1* se SIM
-• Digite *2* se NÃO
-
-📋 *Navegação:*
-• Digite *0* para voltar ao menu principal
-• Digite *5* para encerrar atendimento`
+		log.Debug("Usuário tem senha bloqueada")
+		message := conn.Render(m, "aplicativo_bloqueada", nil)
 		
 		m.Reply(message)
 		return true
 		
 	case "4", "voltar menu", "menu inicial":
-		fmt.Printf("🔄 [APLICATIVO] Usuário quer voltar ao menu inicial\n")
-		err := ChangeUserStage(m.Sender.ToNonAD().User, "default")
+		log.Debug("Usuário quer voltar ao menu inicial")
+		err := ChangeUserStage(conn.Session.ID, m.Sender.ToNonAD().User, conn.Session.RootStage)
 		if err != nil {
-			fmt.Printf("❌ [APLICATIVO] Erro ao mudar stage: %s\n", err.Error())
-			m.Reply("❌ Erro ao voltar: " + err.Error())
+			log.Error("Erro ao mudar stage", "error", err)
+			m.Reply(conn.Render(m, "erro_voltar", map[string]interface{}{"Erro": err.Error()}))
 			return false
 		}
-		fmt.Printf("✅ [APLICATIVO] Stage mudado para 'default'\n")
-		defaultStage := GetStage("default")
+		log.Debug("Stage mudado para default")
+		defaultStage := GetStage(conn.Session.RootStage)
 		if defaultStage != nil && defaultStage.Handler != nil {
-			fmt.Printf("🔄 [APLICATIVO] Executando handler do stage default\n")
-			userStage, _ := GetUserStage(m.Sender.ToNonAD().User)
+			log.Debug("Executando handler do stage default")
+			userStage, _ := GetUserStage(conn.Session.ID, m.Sender.ToNonAD().User)
 			defaultStage.Handler(conn, m, userStage)
-			fmt.Printf("✅ [APLICATIVO] Handler do default executado\n")
+			log.Debug("Handler do default executado")
 		} else {
-			fmt.Printf("❌ [APLICATIVO] Stage default não encontrado ou sem handler\n")
+			log.Error("Stage default não encontrado ou sem handler")
 		}
 		return true
 		
 	case "5", "encerrar", "sair", "fim":
-		fmt.Printf("🔄 [APLICATIVO] Usuário quer encerrar atendimento\n")
-		message := `👋 *Atendimento encerrado!*
-
-Obrigado por entrar em contato conosco.
-
-Se precisar de mais alguma coisa, é só me chamar novamente! 😊`
+		log.Debug("Usuário quer encerrar atendimento")
+		message := conn.Render(m, "encerrado", nil)
 		
 		m.Reply(message)
 		return true
 		
 	// Sub-opções para senha bloqueada
 	case "sim", "1 sim":
-		fmt.Printf("🔄 [APLICATIVO] Usuário confirmou que tem senha bloqueada\n")
-		message := `📞 *Atendimento para senha bloqueada*
-
-Informe sua matrícula e aguarde um instante, você será atendido em breve.
-
-Nossa equipe entrará em contato com você para solucionar o bloqueio o mais breve possível.
-
-📋 *Navegação:*
-• Digite *0* para voltar ao menu principal
-• Digite *5* para encerrar atendimento`
+		log.Debug("Usuário confirmou que tem senha bloqueada")
+		message := conn.Render(m, "aplicativo_bloqueada_sim", nil)
 		
 		m.Reply(message)
 		return true
 		
 	case "não", "nao", "2 não", "2 nao":
-		fmt.Printf("🔄 [APLICATIVO] Usuário negou que tem senha bloqueada\n")
-		message := `📧 *Reporte o erro*
-
-Envie um print da tela com o erro para o e-mail cooperativa@gruposbf.com.br para que possamos verificar o erro.
-
-Nossa equipe entrará em contato com você para solucionar o bloqueio o mais breve possível.
-
-📋 *Navegação:*
-• Digite *0* para voltar ao menu principal
-• Digite *5* para encerrar atendimento`
+		log.Debug("Usuário negou que tem senha bloqueada")
+		message := conn.Render(m, "aplicativo_bloqueada_nao", nil)
 		
 		m.Reply(message)
 		return true
 		
 	default:
-		fmt.Printf("🔄 [APLICATIVO] Enviando mensagem padrão do aplicativo\n")
+		log.Debug("Enviando mensagem padrão do aplicativo")
 		// Mostra o menu do aplicativo/senha
-		message := `📱 *APLICATIVO OU SENHA DE ACESSO*
-
-Escolha a opção desejada:
-
-1️⃣ *Como baixar o aplicativo*
-2️⃣ *Esqueci minha senha de acesso ao aplicativo*
-3️⃣ *Senha bloqueada*
-4️⃣ *Voltar ao menu inicial*
-5️⃣ *Encerrar atendimento*
-
-💡 *Como usar:*
-• Digite o *número* da opção (ex: 1, 2, 3...)
-• Digite palavras-chave como *baixar*, *senha*, *bloqueada*
-
-Escolha uma opção para continuar! ⬇️`
+		message := conn.Render(m, "aplicativo", nil)
 		
-		m.Reply(message)
+		m.ReplyMenu(GetStage("aplicativo"), message)
 		return true
 	}
-	
-	fmt.Printf("⚠️ [APLICATIVO] Nenhum caso foi executado para: '%s'\n", text)
-	return false
 }
 
+// Origem (pacote/arquivo:linha) de cada registro de stage, mantida entre
+// chamadas de InitStages para detectar IDs registrados em mais de um lugar
+var stageRegistrations = make(map[string][]string)
+
 // Registra um novo stage
 func RegisterStage(stage *Stage) {
-	if stages == nil {
-		stages = make(map[string]*Stage)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	
+	source := "?"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		source = fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line)
 	}
+	previous := stageRegistrations[stage.ID]
+	if !slices.Contains(previous, source) {
+		if len(previous) > 0 {
+			helpers.Logger("stages").Warn("Stage registrado mais de uma vez, o último registro prevalece",
+				"stage", stage.ID, "source", source, "previous", strings.Join(previous, ", "))
+		}
+		stageRegistrations[stage.ID] = append(previous, source)
+	}
+	
 	stages[stage.ID] = stage
 }
 
+// Cópia do registro de stages (vazio antes da inicialização)
+func currentStages() map[string]*Stage {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	
+	registry := make(map[string]*Stage, len(stages))
+	for id, stage := range stages {
+		registry[id] = stage
+	}
+	return registry
+}
+
+// Locais em que cada stage foi registrado (mais de um indica ID repetido)
+func StageRegistrations() map[string][]string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	
+	registrations := make(map[string][]string, len(stageRegistrations))
+	for id, sources := range stageRegistrations {
+		registrations[id] = append([]string(nil), sources...)
+	}
+	return registrations
+}
+
 // Obtém um stage por ID
 func GetStage(id string) *Stage {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
 	return stages[id]
 }
 
-// Obtém todos os stages registrados
+// Obtém todos os stages registrados (cópia do registro)
 func GetAllStages() map[string]*Stage {
-	return stages
+	return currentStages()
 }
 
-// Obtém o stage atual do usuário
-func GetUserStage(userID string) (*UserStage, error) {
-	query := "SELECT user_id, current_stage, data, created_at, updated_at FROM user_stages WHERE user_id = ?"
-	row := db.QueryRow(query, userID)
-	
-	var userStage UserStage
-	var dataJSON string
-	
-	err := row.Scan(&userStage.UserID, &userStage.CurrentStage, &dataJSON, &userStage.CreatedAt, &userStage.UpdatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-		// Usuário não existe, retorna stage padrão
+// Obtém o stage atual do usuário na sessão
+func GetUserStage(sessionID string, userID string) (*UserStage, error) {
+	return getUserStage(GetStateStore(), sessionID, userID)
+}
+
+func getUserStage(store StateStore, sessionID string, userID string) (*UserStage, error) {
+	userStage, err := store.Get(sessionID, userID)
+	if err == ErrUserStageNotFound {
+		// Usuário não existe, retorna o stage raiz da sessão
+		rootStage := "default"
+		if session := GetSession(sessionID); session != nil {
+			rootStage = session.RootStage
+		}
 		return &UserStage{
-			UserID:      userID,
-			CurrentStage: "default",
-			Data:        make(map[string]interface{}),
-			CreatedAt:   time.Now().Unix(),
-			UpdatedAt:   time.Now().Unix(),
+			SessionID:    sessionID,
+			UserID:       userID,
+			CurrentStage: rootStage,
+			Data:         make(map[string]interface{}),
+			CreatedAt:    time.Now().Unix(),
+			UpdatedAt:    time.Now().Unix(),
 		}, nil
-		}
-		return nil, err
-	}
-	
-	// Deserializa os dados JSON
-	if dataJSON != "" {
-		err = json.Unmarshal([]byte(dataJSON), &userStage.Data)
-		if err != nil {
-			userStage.Data = make(map[string]interface{})
-		}
-	} else {
-		userStage.Data = make(map[string]interface{})
 	}
-	
-	return &userStage, nil
+	return userStage, err
 }
 
 // Salva ou atualiza o stage do usuário
 func SaveUserStage(userStage *UserStage) error {
-	dataJSON, err := json.Marshal(userStage.Data)
-	if err != nil {
-		return err
-	}
-	
-	now := time.Now().Unix()
-	userStage.UpdatedAt = now
-	
-	query := `
-	INSERT OR REPLACE INTO user_stages (user_id, current_stage, data, created_at, updated_at)
-	VALUES (?, ?, ?, ?, ?)`
-	
-	_, err = db.Exec(query, userStage.UserID, userStage.CurrentStage, string(dataJSON), userStage.CreatedAt, userStage.UpdatedAt)
-	return err
+	userStage.UpdatedAt = time.Now().Unix()
+	return GetStateStore().Save(userStage)
+}
+
+// Remove o estado do usuário: a próxima mensagem começa no stage raiz
+func DeleteUserStage(sessionID string, userID string) error {
+	return GetStateStore().Delete(sessionID, userID)
+}
+
+// Lista os usuários da sessão que estão no stage ("" = todos)
+func ListUserStages(sessionID string, stageID string) ([]*UserStage, error) {
+	return GetStateStore().ListByStage(sessionID, stageID)
 }
 
 // Muda o usuário para um novo stage
-func ChangeUserStage(userID string, newStageID string) error {
-	return ChangeUserStageWithMessage(userID, newStageID, nil, nil)
+func ChangeUserStage(sessionID string, userID string, newStageID string) error {
+	return ChangeUserStageWithMessage(sessionID, userID, newStageID, nil, nil)
 }
 
 // ChangeUserStageWithMessage muda o stage do usuário e opcionalmente executa o handler
-func ChangeUserStageWithMessage(userID string, newStageID string, conn *IClient, m *IMessage) error {
-	userStage, err := GetUserStage(userID)
-	if err != nil {
-		return err
-	}
-	
+func ChangeUserStageWithMessage(sessionID string, userID string, newStageID string, conn *IClient, m *IMessage) error {
 	// Verifica se o stage existe
 	stage := GetStage(newStageID)
 	if stage == nil {
 		return fmt.Errorf("stage '%s' não encontrado", newStageID)
 	}
 	
-	// Verifica se o usuário pode acessar este stage
-	if stage.IsOwner && !isOwner(userID) {
+	// Verifica se o usuário pode acessar este stage e, com a mensagem, se a
+	// conversa atende às restrições do stage (IsOwner, IsGroup, IsPrivate)
+	if m != nil {
+		if err := checkStageScope(stage, m); err != nil {
+			return err
+		}
+	} else if session := GetSession(sessionID); stage.IsOwner && (session == nil || !session.IsOwner(userID)) {
 		return fmt.Errorf("você não tem permissão para acessar este stage")
 	}
 	
-	userStage.CurrentStage = newStageID
-	userStage.Data = make(map[string]interface{}) // Limpa dados do stage anterior
-	
-	err = SaveUserStage(userStage)
+	// Lê e grava o estado na mesma transação
+	var userStage *UserStage
+	err := GetStateStore().WithTx(func(tx StateStore) error {
+		var err error
+		userStage, err = getUserStage(tx, sessionID, userID)
+		if err != nil {
+			return err
+		}
+		userStage.CurrentStage = newStageID
+		userStage.Data = make(map[string]interface{}) // Limpa dados do stage anterior
+		userStage.UpdatedAt = time.Now().Unix()
+		return tx.Save(userStage)
+	})
 	if err != nil {
 		return err
 	}
 	
 	// Se foi fornecido conn e m, executa o handler do novo stage
 	if conn != nil && m != nil && stage.Handler != nil {
+		conn.Typing = conn.stageTyping(stage)
 		// Executa o handler do novo stage diretamente
 		stage.Handler(conn, m, userStage)
 	}
@@ -653,6 +675,40 @@ func ChangeUserStageWithMessage(userID string, newStageID string, conn *IClient,
 	return nil
 }
 
+// Stage que não pode atender a conversa (owner, grupo ou conversa privada)
+type StageScopeError struct {
+	Stage    string
+	Template string // Texto explicado ao usuário
+}
+
+func (e *StageScopeError) Error() string {
+	return fmt.Sprintf("stage '%s' não disponível nesta conversa (%s)", e.Stage, e.Template)
+}
+
+// Verifica as restrições do stage para a mensagem
+func checkStageScope(stage *Stage, m *IMessage) error {
+	switch {
+	case stage.IsOwner && !m.IsOwner:
+		return &StageScopeError{Stage: stage.ID, Template: "stage_sem_permissao"}
+	case stage.IsGroup && !m.Info.IsGroup:
+		return &StageScopeError{Stage: stage.ID, Template: "stage_apenas_grupos"}
+	case stage.IsPrivate && m.Info.IsGroup:
+		return &StageScopeError{Stage: stage.ID, Template: "stage_apenas_privado"}
+	}
+	return nil
+}
+
+// Responde o erro de uma mudança de stage: restrições do stage têm texto
+// próprio, os demais erros usam erro_acesso
+func replyStageError(conn *IClient, m *IMessage, err error) {
+	var scope *StageScopeError
+	if errors.As(err, &scope) {
+		m.Reply(conn.Render(m, scope.Template, nil))
+		return
+	}
+	m.Reply(conn.Render(m, "erro_acesso", map[string]interface{}{"Erro": err.Error()}))
+}
+
 // Verifica se o usuário pode navegar para um stage específico
 func CanNavigateToStage(userID string, fromStageID string, toStageID string) bool {
 	fromStage := GetStage(fromStageID)
@@ -675,89 +731,91 @@ func CanNavigateToStage(userID string, fromStageID string, toStageID string) boo
 func ProcessStageMessage(conn *IClient, m *IMessage) bool {
 	userID := m.Sender.ToNonAD().User
 	
-	fmt.Printf("🔍 [STAGES] Processando mensagem '%s' do usuário %s\n", m.Text, userID)
+	// Respostas de listas e botões chegam como o ID da opção escolhida
+	if m.SelectedID != "" {
+		m.Text = m.SelectedID
+	}
+	
+	log := m.Log.With("component", "stages")
+	log.Debug("Processando mensagem", "length", len(m.Text))
 	
-	// Verifica se o usuário está autorizado (apenas 5514991983652)
-	authorizedNumber := "5514991983652"
-	if userID != authorizedNumber {
-		fmt.Printf("❌ [STAGES] Usuário não autorizado: %s\n", userID)
-		m.Reply("❌ *Acesso não autorizado*\n\nEste atendimento é restrito a usuários específicos.\n\nSe você acredita que deveria ter acesso, entre em contato com a administração.")
+	// Verifica se o usuário está autorizado nesta sessão
+	if !conn.Session.IsAuthorized(userID) {
+		log.Warn("Usuário não autorizado")
+		m.Reply(conn.Render(m, "acesso_negado", nil))
 		return false
 	}
 	
+	// Comandos de idioma valem em qualquer stage
+	if handleLocaleCommand(conn, m) {
+		return true
+	}
+	
+	// Owners podem recarregar os textos sem reiniciar
+	if handleReloadCommand(conn, m) {
+		return true
+	}
+	
+	// Pedido de atendimento humano vale em qualquer stage
+	if handleHandoffCommand(conn, m) {
+		return true
+	}
+	
 	// Obtém o stage atual do usuário
-	userStage, err := GetUserStage(userID)
+	userStage, err := GetUserStage(conn.Session.ID, userID)
 	if err != nil {
-		fmt.Printf("❌ [STAGES] Erro ao obter stage do usuário: %s\n", err.Error())
-		m.Reply("Erro ao obter informações do usuário: " + err.Error())
+		log.Error("Erro ao obter stage do usuário", "error", err)
+		m.Reply(conn.Render(m, "erro_usuario", map[string]interface{}{"Erro": err.Error()}))
 		return false
 	}
 	
-	fmt.Printf("🔍 [STAGES] Usuário está no stage: %s\n", userStage.CurrentStage)
+	log.Debug("Stage atual do usuário", "stage", userStage.CurrentStage)
 	
 	// Obtém o stage atual
 	stage := GetStage(userStage.CurrentStage)
 	if stage == nil {
-		// Se o stage não existe, volta para o default
-		userStage.CurrentStage = "default"
+		// Se o stage não existe, volta para o stage raiz da sessão
+		userStage.CurrentStage = conn.Session.RootStage
 		SaveUserStage(userStage)
-		stage = GetStage("default")
+		stage = GetStage(conn.Session.RootStage)
 		if stage == nil {
-			m.Reply("Sistema de stages não inicializado corretamente.")
+			m.Reply(conn.Render(m, "erro_sistema", nil))
 			return false
 		}
 	}
 	 
 	// Verifica permissões do stage
-	if stage.IsOwner && !m.IsOwner {
-		m.Reply("Você não tem permissão para acessar este stage.")
-		return false
-	}
-	
-	if stage.IsGroup && !m.Info.IsGroup {
-		m.Reply("Este stage só funciona em grupos.")
-		return false
-	}
-	
-	if stage.IsPrivate && m.Info.IsGroup {
-		m.Reply("Este stage só funciona em conversas privadas.")
+	if err := checkStageScope(stage, m); err != nil {
+		replyStageError(conn, m, err)
 		return false
 	}
 	
 	// Executa o handler do stage
 	if stage.Handler != nil {
-		fmt.Printf("🔄 [STAGES] Executando handler do stage '%s'\n", stage.ID)
-		fmt.Printf("🔄 [STAGES] Handler function: %v\n", stage.Handler)
-		fmt.Printf("🔄 [STAGES] Chamando handler...\n")
+		conn.Typing = conn.stageTyping(stage)
+		conn.MarkRead(m)
+		
+		// Mídias recusadas pelo stage recebem resposta automática
+		if !applyMediaPolicy(conn, m, stage, userStage) {
+			return true
+		}
+		started := time.Now()
 		result := stage.Handler(conn, m, userStage)
-		fmt.Printf("✅ [STAGES] Handler executado, resultado: %v\n", result)
+		log.Info("Handler executado", "stage", stage.ID, "result", result, "duration", time.Since(started).Round(time.Millisecond).String())
 		return result
 	} else {
-		fmt.Printf("❌ [STAGES] Stage sem handler\n")
+		log.Error("Stage sem handler", "stage", stage.ID)
 	}
 	
 	return false
 }
 
-// Função auxiliar para verificar se é owner
-func isOwner(userID string) bool {
-	owners := os.Getenv("OWNER")
-	if owners == "" {
-		return false
-	}
-	
-	// Verifica se o userID está na lista de owners (separados por vírgula)
-	ownerList := strings.Split(owners, ",")
-	for _, owner := range ownerList {
-		if strings.TrimSpace(owner) == userID {
-			return true
-		}
-	}
-	return false
-}
-
 // Fecha a conexão com o banco de dados
 func CloseStagesDB() error {
+	if store := GetStateStore(); store != nil {
+		store.Close()
+		SetStateStore(nil)
+	}
 	if db != nil {
 		return db.Close()
 	}
@@ -0,0 +1,156 @@
+package libs
+
+import (
+	"hisoka/src/config"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const testPhone = "5511999990000"
+
+// Prepara o motor sem WhatsApp e sem arquivos (STATE_STORE=memory): estado e
+// stages.db em memória, catálogo embutido e os stages básicos
+func newTestClient(t *testing.T, allowed ...string) (*IClient, *FakeTransport) {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.StateStore = "memory"
+	cfg.Typing.Enabled = false
+	cfg.InteractiveMenus = false
+	if err := InitStages(cfg); err != nil {
+		t.Fatalf("InitStages: %v", err)
+	}
+	t.Cleanup(func() { CloseStagesDB() })
+	if _, ok := GetStateStore().(*MemoryStateStore); !ok {
+		t.Fatalf("STATE_STORE=memory usando %T", GetStateStore())
+	}
+	if err := LoadTemplates(cfg); err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+
+	return NewFakeClient(&Session{ID: DefaultSessionID, RootStage: "default", AllowedUsers: allowed, Config: cfg})
+}
+
+// Envia o texto e retorna o stage do usuário e a última resposta
+func send(t *testing.T, conn *IClient, fake *FakeTransport, text string) (string, string) {
+	t.Helper()
+
+	ProcessStageMessage(conn, NewTextMessage(conn, testPhone, text))
+	userStage, err := GetUserStage(conn.Session.ID, testPhone)
+	if err != nil {
+		t.Fatalf("GetUserStage: %v", err)
+	}
+	last := fake.Last()
+	if last == nil {
+		t.Fatalf("%q: nenhuma resposta enviada", text)
+	}
+	return userStage.CurrentStage, last.Text()
+}
+
+func TestDefaultHandlerShowsMenu(t *testing.T) {
+	conn, fake := newTestClient(t)
+
+	stage, reply := send(t, conn, fake, "oi")
+	if stage != "default" {
+		t.Errorf("stage = %q, esperado default", stage)
+	}
+	if !strings.Contains(reply, "MENU PRINCIPAL") {
+		t.Errorf("resposta sem o menu principal:\n%s", reply)
+	}
+	if got := fake.Last().To.User; got != testPhone {
+		t.Errorf("resposta enviada para %q, esperado %q", got, testPhone)
+	}
+}
+
+func TestDefaultHandlerMovesToAdesao(t *testing.T) {
+	conn, fake := newTestClient(t)
+
+	stage, reply := send(t, conn, fake, "1")
+	if stage != "adesao" {
+		t.Errorf("stage = %q, esperado adesao", stage)
+	}
+	if !strings.Contains(reply, "PROCESSO DE ADESÃO") {
+		t.Errorf("resposta sem as instruções de adesão:\n%s", reply)
+	}
+}
+
+func TestAdesaoHandlerReturnsToDefault(t *testing.T) {
+	conn, fake := newTestClient(t)
+	send(t, conn, fake, "1")
+
+	stage, reply := send(t, conn, fake, "0")
+	if stage != "default" {
+		t.Errorf("stage = %q, esperado default", stage)
+	}
+	if !strings.Contains(reply, "MENU PRINCIPAL") {
+		t.Errorf("resposta sem o menu principal:\n%s", reply)
+	}
+}
+
+func TestUnauthorizedUserIsDenied(t *testing.T) {
+	conn, fake := newTestClient(t, "5511888880000")
+
+	if ProcessStageMessage(conn, NewTextMessage(conn, testPhone, "1")) {
+		t.Error("ProcessStageMessage = true para usuário fora de ALLOWED_USERS")
+	}
+	if len(fake.Messages()) != 1 {
+		t.Fatalf("%d mensagens enviadas, esperado 1", len(fake.Messages()))
+	}
+	if reply := fake.Last().Text(); !strings.Contains(reply, "Acesso não autorizado") {
+		t.Errorf("resposta sem o aviso de acesso negado:\n%s", reply)
+	}
+
+	userStage, err := GetUserStage(conn.Session.ID, testPhone)
+	if err != nil {
+		t.Fatalf("GetUserStage: %v", err)
+	}
+	if userStage.CurrentStage != "default" {
+		t.Errorf("stage = %q, usuário negado não deveria mudar de stage", userStage.CurrentStage)
+	}
+}
+
+func TestPrivateStageRefusedFromGroup(t *testing.T) {
+	conn, fake := newTestClient(t)
+
+	m := NewMessage(conn, MessageParams{
+		Chat:   types.NewJID("120363000000000000", types.GroupServer),
+		Sender: types.NewJID(testPhone, types.DefaultUserServer),
+		Text:   "9",
+	})
+	if ProcessStageMessage(conn, m) {
+		t.Error("ProcessStageMessage = true ao abrir o informe em um grupo")
+	}
+	if reply := fake.Last().Text(); !strings.Contains(reply, "conversas privadas") {
+		t.Errorf("resposta sem o aviso de stage privado:\n%s", reply)
+	}
+
+	userStage, err := GetUserStage(conn.Session.ID, testPhone)
+	if err != nil {
+		t.Fatalf("GetUserStage: %v", err)
+	}
+	if userStage.CurrentStage != "default" {
+		t.Errorf("stage = %q, o informe não deveria ser aberto em grupos", userStage.CurrentStage)
+	}
+}
+
+func TestLocaleIsKeptInStateAcrossStages(t *testing.T) {
+	conn, fake := newTestClient(t)
+
+	send(t, conn, fake, "idioma en")
+	userStage, err := GetStateStore().Get(conn.Session.ID, testPhone)
+	if err != nil {
+		t.Fatalf("idioma não salvo no StateStore: %v", err)
+	}
+	if userStage.Locale != "en" {
+		t.Errorf("Locale = %q, esperado en", userStage.Locale)
+	}
+
+	if err := ChangeUserStage(conn.Session.ID, testPhone, "adesao"); err != nil {
+		t.Fatalf("ChangeUserStage: %v", err)
+	}
+	if locale := GetUserLocale(conn.Session.ID, testPhone); locale != "en" {
+		t.Errorf("idioma após mudar de stage = %q, esperado en", locale)
+	}
+}
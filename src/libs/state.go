@@ -0,0 +1,342 @@
+package libs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hisoka/src/config"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	_ "github.com/lib/pq"
+)
+
+// Retornado por StateStore.Get quando o usuário ainda não tem estado salvo
+var ErrUserStageNotFound = errors.New("estado do usuário não encontrado")
+
+// StateStore guarda o stage atual e os dados de cada usuário por sessão
+type StateStore interface {
+	Get(sessionID string, userID string) (*UserStage, error)
+	Save(userStage *UserStage) error
+	Delete(sessionID string, userID string) error
+	// Usuários da sessão no stage informado ("" = todos os stages)
+	ListByStage(sessionID string, stageID string) ([]*UserStage, error)
+	// Executa fn em uma transação: as alterações feitas pelo store recebido
+	// só valem se fn retornar nil
+	WithTx(fn func(tx StateStore) error) error
+	Close() error
+}
+
+var (
+	stateMu    sync.RWMutex
+	stateStore StateStore
+)
+
+// Define o store de estado usado pelo motor
+func SetStateStore(store StateStore) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	stateStore = store
+}
+
+// Store de estado em uso
+func GetStateStore() StateStore {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	return stateStore
+}
+
+// NewStateStoreFromConfig cria o store configurado em STATE_STORE: "sqlite"
+// (padrão, tabela user_stages do stages.db), "postgres" (STATE_DATABASE_URL,
+// com as migrações de migrations/postgres) ou "memory" (sem arquivos, para
+// testes e simulações). Apenas o estado dos usuários muda de lugar: as demais
+// tabelas continuam no stages.db (ver OpenStagesDB).
+func NewStateStoreFromConfig(cfg *config.Config) (StateStore, error) {
+	switch kind := cfg.StateStore; kind {
+	case "", "sqlite", "sqlite3":
+		if db == nil {
+			return nil, fmt.Errorf("stages.db não inicializado")
+		}
+		return NewSQLStateStore(db, "sqlite3")
+	case "postgres", "postgresql":
+		conn, err := OpenStateDatabase(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := MigratePostgres(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		store, err := NewSQLStateStore(conn, "postgres")
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		store.owned = true
+		return store, nil
+	case "memory":
+		return NewMemoryStateStore(), nil
+	default:
+		return nil, fmt.Errorf("STATE_STORE desconhecido: %s (use sqlite, postgres ou memory)", kind)
+	}
+}
+
+// OpenStateDatabase conecta ao PostgreSQL de STATE_DATABASE_URL, sem aplicar
+// migrações
+func OpenStateDatabase(cfg *config.Config) (*sql.DB, error) {
+	if cfg.StateDatabaseURL == "" {
+		return nil, fmt.Errorf("STATE_STORE=postgres requer STATE_DATABASE_URL")
+	}
+	conn, err := sql.Open("postgres", cfg.StateDatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	return conn, nil
+}
+
+// Executa consultas no banco ou dentro de uma transação
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// SQLStateStore guarda o estado na tabela user_stages de um banco SQLite ou
+// PostgreSQL
+type SQLStateStore struct {
+	db      *sql.DB
+	exec    sqlExecutor
+	dialect string
+	owned   bool // Close fecha a conexão (aberta pelo próprio store)
+}
+
+// NewSQLStateStore usa a conexão informada ("sqlite3" ou "postgres"). A
+// tabela user_stages é criada pelas migrações (Migrate ou MigratePostgres).
+func NewSQLStateStore(conn *sql.DB, dialect string) (*SQLStateStore, error) {
+	if dialect != "sqlite3" && dialect != "postgres" {
+		return nil, fmt.Errorf("dialeto não suportado: %s", dialect)
+	}
+	return &SQLStateStore{db: conn, exec: conn, dialect: dialect}, nil
+}
+
+func (s *SQLStateStore) rebind(query string) string {
+	return rebind(s.dialect, query)
+}
+
+// Troca os "?" pelos marcadores do PostgreSQL ($1, $2...)
+func rebind(dialect string, query string) string {
+	if dialect != "postgres" {
+		return query
+	}
+	var out strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			out.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+func (s *SQLStateStore) Get(sessionID string, userID string) (*UserStage, error) {
+	row := s.exec.QueryRow(s.rebind(
+		"SELECT session_id, user_id, current_stage, data, locale, created_at, updated_at FROM user_stages WHERE session_id = ? AND user_id = ?",
+	), sessionID, userID)
+	userStage, err := scanUserStage(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserStageNotFound
+	}
+	return userStage, err
+}
+
+func (s *SQLStateStore) Save(userStage *UserStage) error {
+	dataJSON, err := json.Marshal(userStage.Data)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec.Exec(s.rebind(`
+	INSERT INTO user_stages (session_id, user_id, current_stage, data, locale, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (session_id, user_id) DO UPDATE SET
+		current_stage = excluded.current_stage,
+		data = excluded.data,
+		locale = excluded.locale,
+		updated_at = excluded.updated_at`),
+		userStage.SessionID, userStage.UserID, userStage.CurrentStage, string(dataJSON), userStage.Locale, userStage.CreatedAt, userStage.UpdatedAt,
+	)
+	return err
+}
+
+func (s *SQLStateStore) Delete(sessionID string, userID string) error {
+	_, err := s.exec.Exec(s.rebind("DELETE FROM user_stages WHERE session_id = ? AND user_id = ?"), sessionID, userID)
+	return err
+}
+
+func (s *SQLStateStore) ListByStage(sessionID string, stageID string) ([]*UserStage, error) {
+	query := "SELECT session_id, user_id, current_stage, data, locale, created_at, updated_at FROM user_stages WHERE session_id = ?"
+	args := []interface{}{sessionID}
+	if stageID != "" {
+		query += " AND current_stage = ?"
+		args = append(args, stageID)
+	}
+	rows, err := s.exec.Query(s.rebind(query+" ORDER BY updated_at DESC"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userStages []*UserStage
+	for rows.Next() {
+		userStage, err := scanUserStage(rows)
+		if err != nil {
+			return nil, err
+		}
+		userStages = append(userStages, userStage)
+	}
+	return userStages, rows.Err()
+}
+
+func (s *SQLStateStore) WithTx(fn func(tx StateStore) error) error {
+	if _, inTx := s.exec.(*sql.Tx); inTx {
+		return fn(s)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLStateStore{db: s.db, exec: tx, dialect: s.dialect}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStateStore) Close() error {
+	if s.owned {
+		return s.db.Close()
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUserStage(row rowScanner) (*UserStage, error) {
+	var userStage UserStage
+	var dataJSON sql.NullString
+	err := row.Scan(&userStage.SessionID, &userStage.UserID, &userStage.CurrentStage, &dataJSON, &userStage.Locale, &userStage.CreatedAt, &userStage.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	userStage.Data = make(map[string]interface{})
+	if dataJSON.String != "" {
+		if err := json.Unmarshal([]byte(dataJSON.String), &userStage.Data); err != nil {
+			userStage.Data = make(map[string]interface{})
+		}
+	}
+	return &userStage, nil
+}
+
+// MemoryStateStore guarda o estado em memória (perdido ao encerrar)
+type MemoryStateStore struct {
+	mu    *sync.Mutex
+	users map[string]*UserStage
+	inTx  bool
+}
+
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{mu: &sync.Mutex{}, users: make(map[string]*UserStage)}
+}
+
+func memoryKey(sessionID string, userID string) string {
+	return sessionID + "\x00" + userID
+}
+
+// Cópia independente, para que alterações feitas pelo handler só valham no Save
+func copyUserStage(userStage *UserStage) *UserStage {
+	copied := *userStage
+	copied.Data = make(map[string]interface{}, len(userStage.Data))
+	if data, err := json.Marshal(userStage.Data); err == nil {
+		json.Unmarshal(data, &copied.Data)
+	}
+	return &copied
+}
+
+func (s *MemoryStateStore) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (s *MemoryStateStore) Get(sessionID string, userID string) (*UserStage, error) {
+	defer s.lock()()
+	userStage, ok := s.users[memoryKey(sessionID, userID)]
+	if !ok {
+		return nil, ErrUserStageNotFound
+	}
+	return copyUserStage(userStage), nil
+}
+
+func (s *MemoryStateStore) Save(userStage *UserStage) error {
+	defer s.lock()()
+	s.users[memoryKey(userStage.SessionID, userStage.UserID)] = copyUserStage(userStage)
+	return nil
+}
+
+func (s *MemoryStateStore) Delete(sessionID string, userID string) error {
+	defer s.lock()()
+	delete(s.users, memoryKey(sessionID, userID))
+	return nil
+}
+
+func (s *MemoryStateStore) ListByStage(sessionID string, stageID string) ([]*UserStage, error) {
+	defer s.lock()()
+	var userStages []*UserStage
+	for _, userStage := range s.users {
+		if userStage.SessionID == sessionID && (stageID == "" || userStage.CurrentStage == stageID) {
+			userStages = append(userStages, copyUserStage(userStage))
+		}
+	}
+	sort.Slice(userStages, func(i, j int) bool {
+		return userStages[i].UpdatedAt > userStages[j].UpdatedAt
+	})
+	return userStages, nil
+}
+
+// A transação trabalha sobre uma cópia do mapa, publicada apenas no sucesso;
+// o store fica bloqueado para as demais goroutines enquanto isso
+func (s *MemoryStateStore) WithTx(fn func(tx StateStore) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]*UserStage, len(s.users))
+	for key, userStage := range s.users {
+		snapshot[key] = userStage
+	}
+	if err := fn(&MemoryStateStore{mu: s.mu, users: snapshot, inTx: true}); err != nil {
+		return err
+	}
+	s.users = snapshot
+	return nil
+}
+
+func (s *MemoryStateStore) Close() error {
+	return nil
+}
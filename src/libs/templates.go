@@ -0,0 +1,445 @@
+package libs
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Catálogo padrão de textos, embutido no binário. TEMPLATES_DIR permite usar
+// um diretório no disco com a mesma estrutura:
+//
+//	vars.json            variáveis da cooperativa (nome, links, e-mail...)
+//	<idioma>/<nome>.tmpl um template por arquivo; nomes com "_" são parciais
+//
+//go:embed all:templates
+var embeddedTemplates embed.FS
+
+// Templates usados pelo próprio motor de stages (fora dos handlers)
+var engineTemplates = []string{
+	"acesso_negado",
+	"erro_usuario",
+	"erro_sistema",
+	"stage_sem_permissao",
+	"stage_apenas_grupos",
+	"stage_apenas_privado",
+	"idiomas",
+	"idioma_alterado",
+	"desculpas_offline",
+	"midia_audio_video",
+	"midia_nao_aceita",
+	"midia_invalida",
+	"chamada_recusada",
+	"recarga_ok",
+	"recarga_erro",
+}
+
+// Dados disponíveis dentro dos templates
+type TemplateData struct {
+	PushName string                 // Nome do usuário no WhatsApp
+	Protocol string                 // Protocolo do atendimento
+	Date     string                 // Data e hora atuais (dd/mm/aaaa hh:mm)
+	Coop     map[string]string      // Variáveis de vars.json
+	Vars     map[string]interface{} // Variáveis informadas pelo handler
+}
+
+type templateCatalog struct {
+	locales       map[string]*template.Template
+	coop          map[string]string
+	defaultLocale string
+}
+
+var (
+	catalogMu sync.RWMutex
+	catalog   *templateCatalog
+)
+
+var templateFuncs = template.FuncMap{
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"brl":     func(value interface{}) string { return FormatBRL(numberValue(value)) },
+	"percent": func(value interface{}) string { return FormatPercent(numberValue(value)) },
+}
+
+// Converte as variáveis numéricas dos templates (ausentes valem zero)
+func numberValue(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+// FormatBRL formata o valor em reais: 1234.5 → "R$ 1.234,50"
+func FormatBRL(value float64) string {
+	sign := ""
+	if value < 0 {
+		sign, value = "-", -value
+	}
+	text := strconv.FormatFloat(value, 'f', 2, 64)
+	integer, cents := text[:len(text)-3], text[len(text)-2:]
+	var groups []string
+	for len(integer) > 3 {
+		groups = append([]string{integer[len(integer)-3:]}, groups...)
+		integer = integer[:len(integer)-3]
+	}
+	groups = append([]string{integer}, groups...)
+	return sign + "R$ " + strings.Join(groups, ".") + "," + cents
+}
+
+// FormatPercent formata o percentual com duas casas: 1.5 → "1,50%"
+func FormatPercent(value float64) string {
+	return strings.Replace(strconv.FormatFloat(value, 'f', 2, 64), ".", ",", 1) + "%"
+}
+
+// Idioma usado quando o usuário não escolheu um (DEFAULT_LOCALE do catálogo
+// carregado; "" antes de LoadTemplates)
+func DefaultLocale() string {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	if catalog == nil {
+		return ""
+	}
+	return catalog.defaultLocale
+}
+
+// LoadTemplates carrega o catálogo de textos de TEMPLATES_DIR ou, se não
+// configurado, do catálogo embutido
+func LoadTemplates(cfg *config.Config) error {
+	loaded, err := loadCatalog(cfg)
+	if err != nil {
+		return err
+	}
+
+	catalogMu.Lock()
+	catalog = loaded
+	catalogMu.Unlock()
+	return nil
+}
+
+// Lê e compila o catálogo sem substituir o catálogo em uso
+func loadCatalog(cfg *config.Config) (*templateCatalog, error) {
+	var fsys fs.FS
+	if dir := cfg.TemplatesDir; dir != "" {
+		fsys = os.DirFS(dir)
+	} else {
+		sub, err := fs.Sub(embeddedTemplates, "templates")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	loaded := &templateCatalog{
+		locales:       make(map[string]*template.Template),
+		coop:          make(map[string]string),
+		defaultLocale: cfg.DefaultLocale,
+	}
+
+	vars, err := fs.ReadFile(fsys, "vars.json")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(vars, &loaded.coop); err != nil {
+			return nil, fmt.Errorf("vars.json inválido: %w", err)
+		}
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		locale := entry.Name()
+		files, err := fs.Glob(fsys, locale+"/*.tmpl")
+		if err != nil {
+			return nil, err
+		}
+
+		set := template.New(locale).Funcs(templateFuncs)
+		for _, file := range files {
+			content, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.TrimSuffix(path.Base(file), ".tmpl")
+			// Remove a quebra de linha final para o texto sair igual ao arquivo
+			text := strings.TrimRight(string(content), "\n")
+			if _, err := set.New(name).Parse(text); err != nil {
+				return nil, fmt.Errorf("template %s/%s: %w", locale, name, err)
+			}
+		}
+		loaded.locales[locale] = set
+	}
+
+	if _, ok := loaded.locales[loaded.defaultLocale]; !ok {
+		return nil, fmt.Errorf("idioma padrão '%s' não encontrado no catálogo de templates", loaded.defaultLocale)
+	}
+	return loaded, nil
+}
+
+// ValidateTemplates verifica se todos os templates referenciados pelos stages
+// e pelo motor existem e executam no idioma padrão (erro) e nos demais
+// idiomas (apenas aviso, esses idiomas usam o padrão como fallback)
+func ValidateTemplates() error {
+	catalogMu.RLock()
+	loaded := catalog
+	catalogMu.RUnlock()
+	if loaded == nil {
+		return fmt.Errorf("catálogo de templates não carregado")
+	}
+
+	var missing []string
+	for _, problem := range templateProblems(loaded, currentStages()) {
+		if problem.Locale == loaded.defaultLocale {
+			missing = append(missing, fmt.Sprintf("%s (%s): %s", problem.Name, problem.Source, problem.Err.Error()))
+		} else {
+			helpers.Logger("templates").Warn("Template com problema, usando o idioma padrão", "locale", problem.Locale, "template", problem.Name, "source", problem.Source, "error", problem.Err, "fallback", loaded.defaultLocale)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("templates inválidos no idioma %s:\n%s", loaded.defaultLocale, strings.Join(missing, "\n"))
+	}
+	return nil
+}
+
+// Template referenciado que não pode ser renderizado em um idioma
+type templateProblem struct {
+	Locale string
+	Name   string
+	Source string // Quem usa o template ("motor de stages" ou "stage <id>")
+	Err    error
+}
+
+// Renderiza em todos os idiomas os templates usados pelo motor e pelos stages
+// do registro informado
+func templateProblems(loaded *templateCatalog, registry map[string]*Stage) []templateProblem {
+	referenced := map[string]string{}
+	for _, name := range engineTemplates {
+		referenced[name] = "motor de stages"
+	}
+	for _, id := range sortedStageIDs(registry) {
+		for _, name := range registry[id].Templates {
+			if _, ok := referenced[name]; !ok {
+				referenced[name] = "stage " + id
+			}
+		}
+	}
+
+	names := make([]string, 0, len(referenced))
+	for name := range referenced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []templateProblem
+	for _, locale := range Locales() {
+		for _, name := range names {
+			if _, err := loaded.render(locale, name, &TemplateData{}); err != nil {
+				problems = append(problems, templateProblem{Locale: locale, Name: name, Source: referenced[name], Err: err})
+			}
+		}
+	}
+	return problems
+}
+
+// Idiomas disponíveis no catálogo
+func Locales() []string {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	var locales []string
+	if catalog != nil {
+		for locale := range catalog.locales {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Encontra o idioma do catálogo correspondente ao informado pelo usuário
+// ("pt", "PT-br", "en"...); retorna "" se não houver
+func MatchLocale(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return ""
+	}
+	for _, locale := range Locales() {
+		lower := strings.ToLower(locale)
+		if lower == value || strings.SplitN(lower, "-", 2)[0] == value {
+			return locale
+		}
+	}
+	return ""
+}
+
+// Verifica se o template existe no idioma
+func HasTemplate(locale string, name string) bool {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	if catalog == nil || catalog.locales[locale] == nil {
+		return false
+	}
+	return catalog.locales[locale].Lookup(name) != nil
+}
+
+// RenderTemplate executa o template no idioma informado, usando o idioma
+// padrão quando o template não existe ou falha nesse idioma
+func RenderTemplate(locale string, name string, data *TemplateData) (string, error) {
+	catalogMu.RLock()
+	loaded := catalog
+	catalogMu.RUnlock()
+	if loaded == nil {
+		return "", fmt.Errorf("catálogo de templates não carregado")
+	}
+
+	text, err := loaded.render(locale, name, data)
+	if err != nil && locale != loaded.defaultLocale {
+		return loaded.render(loaded.defaultLocale, name, data)
+	}
+	return text, err
+}
+
+func (c *templateCatalog) render(locale string, name string, data *TemplateData) (string, error) {
+	set := c.locales[locale]
+	if set == nil {
+		return "", fmt.Errorf("idioma '%s' não encontrado", locale)
+	}
+	tmpl := set.Lookup(name)
+	if tmpl == nil {
+		return "", fmt.Errorf("template '%s' não encontrado", name)
+	}
+
+	if data.Coop == nil {
+		data.Coop = c.coop
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Render monta o texto do template no idioma do usuário que enviou a mensagem.
+// Em caso de erro o problema é registrado e o nome do template é retornado.
+func (conn *IClient) Render(m *IMessage, name string, vars map[string]interface{}) string {
+	return conn.renderFor(m.Sender.ToNonAD().User, name, &TemplateData{
+		PushName: m.Info.PushName,
+		Protocol: Protocol(m),
+		Vars:     vars,
+	})
+}
+
+// RenderTo monta o texto do template no idioma do usuário, para mensagens
+// que não são respostas (ex: chamadas recusadas, avisos)
+func (conn *IClient) RenderTo(userID string, name string, vars map[string]interface{}) string {
+	return conn.renderFor(userID, name, &TemplateData{Vars: vars})
+}
+
+func (conn *IClient) renderFor(userID string, name string, data *TemplateData) string {
+	data.Date = time.Now().Format("02/01/2006 15:04")
+	text, err := RenderTemplate(GetUserLocale(conn.Session.ID, userID), name, data)
+	if err != nil {
+		helpers.Logger("templates").Error("Erro ao montar template", "template", name, "user", userID, "error", err)
+		return name
+	}
+	return text
+}
+
+// Protocolo do atendimento: data da mensagem seguida do final do seu ID
+func Protocol(m *IMessage) string {
+	id := m.Info.ID
+	if len(id) > 6 {
+		id = id[len(id)-6:]
+	}
+	return m.Info.Timestamp.Format("20060102") + strings.ToUpper(id)
+}
+
+// Obtém o idioma escolhido pelo usuário na sessão (idioma padrão se nenhum).
+// O idioma fica no estado do usuário, no StateStore configurado.
+func GetUserLocale(sessionID string, userID string) string {
+	store := GetStateStore()
+	if store == nil {
+		return DefaultLocale()
+	}
+	userStage, err := store.Get(sessionID, userID)
+	if err != nil {
+		if err != ErrUserStageNotFound {
+			helpers.Logger("templates").Error("Erro ao obter idioma", "session", sessionID, "user", userID, "error", err)
+		}
+		return DefaultLocale()
+	}
+	if userStage.Locale == "" {
+		return DefaultLocale()
+	}
+	return userStage.Locale
+}
+
+// Salva o idioma escolhido pelo usuário na sessão, sem alterar o stage atual
+func SetUserLocale(sessionID string, userID string, locale string) error {
+	return GetStateStore().WithTx(func(tx StateStore) error {
+		userStage, err := getUserStage(tx, sessionID, userID)
+		if err != nil {
+			return err
+		}
+		userStage.Locale = locale
+		userStage.UpdatedAt = time.Now().Unix()
+		return tx.Save(userStage)
+	})
+}
+
+// Trata os comandos "idioma" e "language", disponíveis em qualquer stage.
+// Retorna false se a mensagem não for um desses comandos.
+func handleLocaleCommand(conn *IClient, m *IMessage) bool {
+	fields := strings.Fields(strings.ToLower(m.Text))
+	if len(fields) == 0 || len(fields) > 2 {
+		return false
+	}
+	if fields[0] != "idioma" && fields[0] != "language" {
+		return false
+	}
+
+	if len(fields) == 1 {
+		m.Reply(conn.Render(m, "idiomas", nil))
+		return true
+	}
+
+	locale := MatchLocale(fields[1])
+	if locale == "" {
+		m.Reply(conn.Render(m, "idiomas", nil))
+		return true
+	}
+
+	userID := m.Sender.ToNonAD().User
+	if err := SetUserLocale(conn.Session.ID, userID, locale); err != nil {
+		m.Log.Error("Erro ao salvar idioma", "component", "templates", "error", err)
+		m.Reply(conn.Render(m, "erro_usuario", map[string]interface{}{"Erro": err.Error()}))
+		return true
+	}
+	m.Reply(conn.Render(m, "idioma_alterado", nil))
+	return true
+}
@@ -0,0 +1,110 @@
+package libs
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Situação de um chamado
+const (
+	TicketOpen   = "open"
+	TicketClosed = "closed"
+)
+
+// Chamado aberto pelo atendimento para a equipe, com os dados coletados na
+// conversa (ex: valores de uma simulação de empréstimo)
+type Ticket struct {
+	ID        int64
+	SessionID string
+	UserID    string
+	Kind      string // Assunto do chamado (ex: "emprestimo")
+	Status    string
+	Summary   string
+	Data      map[string]interface{}
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+// Filtro da listagem de chamados (campos vazios não filtram)
+type TicketFilter struct {
+	SessionID string
+	UserID    string
+	Status    string
+	Kind      string
+	Limit     int // 0 = sem limite
+}
+
+// Abre um chamado; ID, status (aberto) e datas são preenchidos aqui
+func CreateTicket(ticket *Ticket) error {
+	if ticket.Data == nil {
+		ticket.Data = make(map[string]interface{})
+	}
+	data, err := json.Marshal(ticket.Data)
+	if err != nil {
+		return err
+	}
+	ticket.Status = TicketOpen
+	ticket.CreatedAt = time.Now().Unix()
+	ticket.UpdatedAt = ticket.CreatedAt
+
+	result, err := db.Exec(
+		`INSERT INTO tickets (session_id, user_id, kind, status, summary, data, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		ticket.SessionID, ticket.UserID, ticket.Kind, ticket.Status, ticket.Summary, string(data), ticket.CreatedAt, ticket.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	ticket.ID, err = result.LastInsertId()
+	return err
+}
+
+// Lista os chamados do filtro, do mais recente para o mais antigo
+func ListTickets(filter TicketFilter) ([]*Ticket, error) {
+	var where []string
+	var args []interface{}
+	for _, field := range []struct{ column, value string }{
+		{"session_id", filter.SessionID},
+		{"user_id", filter.UserID},
+		{"status", filter.Status},
+		{"kind", filter.Kind},
+	} {
+		if field.value != "" {
+			where = append(where, field.column+" = ?")
+			args = append(args, field.value)
+		}
+	}
+
+	query := "SELECT id, session_id, user_id, kind, status, summary, data, created_at, updated_at FROM tickets"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tickets []*Ticket
+	for rows.Next() {
+		var ticket Ticket
+		var data string
+		err := rows.Scan(&ticket.ID, &ticket.SessionID, &ticket.UserID, &ticket.Kind, &ticket.Status,
+			&ticket.Summary, &data, &ticket.CreatedAt, &ticket.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &ticket.Data); err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, &ticket)
+	}
+	return tickets, rows.Err()
+}
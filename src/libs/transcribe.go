@@ -0,0 +1,186 @@
+package libs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hisoka/src/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transcriber converte áudios (mensagens de voz) em texto
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, mimeType string) (string, error)
+}
+
+var (
+	transcriberMu sync.RWMutex
+	transcriber   Transcriber
+)
+
+// Define o transcritor usado para as mensagens de voz (nil desativa)
+func SetTranscriber(t Transcriber) {
+	transcriberMu.Lock()
+	transcriber = t
+	transcriberMu.Unlock()
+}
+
+// Obtém o transcritor configurado (nil se desativado)
+func GetTranscriber() Transcriber {
+	transcriberMu.RLock()
+	defer transcriberMu.RUnlock()
+	return transcriber
+}
+
+// NewTranscriberFromConfig cria o transcritor configurado em TRANSCRIBER:
+// "whisper" (whisper.cpp local), "fake" (texto fixo de TRANSCRIBER_FAKE_TEXT)
+// ou vazio para desativar a transcrição
+func NewTranscriberFromConfig(cfg config.TranscriberConfig) (Transcriber, error) {
+	switch cfg.Kind {
+	case "":
+		return nil, nil
+	case "whisper":
+		w := &WhisperTranscriber{
+			Binary:   cfg.Binary,
+			Model:    cfg.Model,
+			Language: cfg.Language,
+			FFmpeg:   cfg.FFmpeg,
+			Timeout:  cfg.Timeout,
+		}
+		if w.Model == "" {
+			return nil, fmt.Errorf("WHISPER_MODEL não configurado")
+		}
+		if _, err := exec.LookPath(w.Binary); err != nil {
+			return nil, fmt.Errorf("whisper.cpp não encontrado (%s): %w", w.Binary, err)
+		}
+		if _, err := exec.LookPath(w.FFmpeg); err != nil {
+			return nil, fmt.Errorf("ffmpeg não encontrado (%s): %w", w.FFmpeg, err)
+		}
+		return w, nil
+	case "fake":
+		return &FakeTranscriber{Text: cfg.FakeText}, nil
+	default:
+		return nil, fmt.Errorf("TRANSCRIBER inválido: %s", cfg.Kind)
+	}
+}
+
+// WhisperTranscriber transcreve chamando o whisper.cpp instalado na máquina.
+// O áudio do WhatsApp (ogg/opus) é convertido com o ffmpeg para WAV 16 kHz
+// mono, o formato esperado pelo whisper.cpp.
+type WhisperTranscriber struct {
+	Binary   string // Executável do whisper.cpp (ex: whisper-cli)
+	Model    string // Arquivo do modelo (ex: ggml-base.bin)
+	Language string // Idioma do áudio (ex: pt)
+	FFmpeg   string // Executável do ffmpeg
+	Timeout  time.Duration
+}
+
+func (w *WhisperTranscriber) Transcribe(ctx context.Context, audio []byte, mimeType string) (string, error) {
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+
+	dir, err := os.MkdirTemp("", "transcribe-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "audio"+mediaExtension(mimeType, ""))
+	wav := filepath.Join(dir, "audio.wav")
+	output := filepath.Join(dir, "transcript")
+	if err := os.WriteFile(input, audio, 0600); err != nil {
+		return "", err
+	}
+
+	if err := runCommand(ctx, w.FFmpeg, "-nostdin", "-loglevel", "error", "-i", input, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wav); err != nil {
+		return "", fmt.Errorf("ffmpeg: %w", err)
+	}
+	if err := runCommand(ctx, w.Binary, "-m", w.Model, "-l", w.Language, "-nt", "-otxt", "-of", output, "-f", wav); err != nil {
+		return "", fmt.Errorf("whisper.cpp: %w", err)
+	}
+
+	text, err := os.ReadFile(output + ".txt")
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(string(text)), " "), nil
+}
+
+func runCommand(ctx context.Context, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			lines := strings.Split(msg, "\n")
+			return fmt.Errorf("%w: %s", err, lines[len(lines)-1])
+		}
+		return err
+	}
+	return nil
+}
+
+// FakeTranscriber devolve sempre o mesmo texto (ou erro) e registra os áudios
+// recebidos. Usado em testes e no desenvolvimento sem o whisper.cpp.
+type FakeTranscriber struct {
+	Text string
+	Err  error
+
+	mu    sync.Mutex
+	Calls [][]byte
+}
+
+func (f *FakeTranscriber) Transcribe(ctx context.Context, audio []byte, mimeType string) (string, error) {
+	f.mu.Lock()
+	f.Calls = append(f.Calls, audio)
+	f.mu.Unlock()
+	return f.Text, f.Err
+}
+
+// transcribeAudio guarda o áudio no media store, transcreve e usa o texto
+// como se o membro tivesse digitado. Retorna false se não for possível.
+func transcribeAudio(conn *IClient, m *IMessage, t Transcriber) bool {
+	log := m.Log.With("component", "transcribe")
+	ref, data, err := storeInboundMedia(conn, m, &MediaPolicy{Accept: []string{MediaAudio}})
+	if err != nil {
+		log.Error("Erro ao guardar áudio", "error", err)
+		return false
+	}
+
+	started := time.Now()
+	text, err := t.Transcribe(context.Background(), data, ref.MimeType)
+	if err != nil {
+		log.Error("Erro ao transcrever áudio", "media_id", ref.ID, "error", err)
+		return false
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		log.Warn("Transcrição vazia", "media_id", ref.ID)
+		return false
+	}
+	log.Info("Áudio transcrito", "media_id", ref.ID, "duration", time.Since(started).Round(time.Millisecond).String())
+	log.Debug("Texto transcrito", "media_id", ref.ID, "length", len(text))
+
+	if err := SaveTranscript(ref.ID, text); err != nil {
+		log.Error("Erro ao salvar transcrição", "media_id", ref.ID, "error", err)
+	}
+
+	m.Body = text
+	m.Text = text
+	m.Args = strings.Fields(text)
+	return true
+}
+
+// Salva a transcrição junto ao áudio no media store
+func SaveTranscript(mediaID int64, transcript string) error {
+	_, err := db.Exec("UPDATE media_files SET transcript = ? WHERE id = ?", transcript, mediaID)
+	return err
+}
@@ -0,0 +1,43 @@
+package libs
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Transport são as operações do WhatsApp usadas pelo IClient. Em produção é o
+// próprio *whatsmeow.Client; nos testes, o FakeTransport.
+type Transport interface {
+	SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	Upload(ctx context.Context, data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+	Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error)
+	SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error
+	MarkRead(ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error
+	RejectCall(callFrom types.JID, callID string) error
+	BuildReaction(chat, sender types.JID, id types.MessageID, reaction string) *waE2E.Message
+	GetGroupInfo(jid types.JID) (*types.GroupInfo, error)
+}
+
+// Messenger é o que os handlers de stage usam para responder. O IClient
+// implementa esta interface sobre um Transport.
+type Messenger interface {
+	SendText(to types.JID, text string, opts *waE2E.ContextInfo, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	SendImage(to types.JID, data []byte, caption string, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error)
+	SendVideo(to types.JID, data []byte, caption string, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error)
+	SendDocument(to types.JID, data []byte, fileName string, caption string, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error)
+	SendSticker(to types.JID, data []byte, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error)
+	SendList(to types.JID, title string, body string, buttonText string, footer string, sections []ListSection, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error)
+	SendButtons(to types.JID, body string, footer string, options []StageOption, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error)
+	SendStageMenu(to types.JID, stage *Stage, fallback string, opts *waE2E.ContextInfo) (whatsmeow.SendResponse, error)
+	Render(m *IMessage, name string, vars map[string]interface{}) string
+	RenderTo(userID string, name string, vars map[string]interface{}) string
+}
+
+var (
+	_ Transport = (*whatsmeow.Client)(nil)
+	_ Messenger = (*IClient)(nil)
+)
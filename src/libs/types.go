@@ -1,13 +1,20 @@
 package libs
 
 import (
+	"hisoka/src/config"
+	"log/slog"
+
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
 )
 
 type IClient struct {
-	WA *whatsmeow.Client
+	WA        *whatsmeow.Client // nil quando o cliente usa um Transport de teste
+	Transport Transport         // Operações de envio/recebimento (normalmente o próprio WA)
+	Session   *Session
+	Config    *config.Config // Configuração da sessão (tempos, mídias, menus...)
+	Typing    *Typing        // Indicador de digitação do stage em execução
 }
 
 // Estruturas do sistema de stages
@@ -16,18 +23,32 @@ type Stage struct {
 	Name        string
 	Description string
 	Handler     func(conn *IClient, m *IMessage, userStage *UserStage) bool
-	NextStages  []string // IDs dos stages que podem ser acessados a partir deste
-	IsOwner     bool     // Se apenas owners podem acessar
-	IsGroup     bool     // Se funciona apenas em grupos
-	IsPrivate   bool     // Se funciona apenas em privado
+	NextStages  []string      // IDs dos stages que podem ser acessados a partir deste
+	IsOwner     bool          // Se apenas owners podem acessar
+	IsGroup     bool          // Se funciona apenas em grupos
+	IsPrivate   bool          // Se funciona apenas em privado
+	Options     []StageOption // Opções do menu, usadas para gerar listas e botões
+	Typing      *Typing       // Indicador de digitação (nil = configuração global)
+	Templates   []string      // Templates usados pelo handler, verificados na inicialização
+	Media       *MediaPolicy  // Mídias aceitas pelo stage (nil = apenas texto)
+}
+
+// Opção de menu de um stage. O ID é entregue ao handler como se o usuário
+// tivesse digitado (ex: "1"), então deve ser um valor que o handler já trata.
+type StageOption struct {
+	ID          string
+	Title       string
+	Description string
 }
 
 type UserStage struct {
-	UserID      string
+	SessionID    string
+	UserID       string
 	CurrentStage string
-	Data        map[string]interface{} // Dados específicos do usuário no stage atual
-	CreatedAt   int64
-	UpdatedAt   int64
+	Data         map[string]interface{} // Dados específicos do usuário no stage atual
+	Locale       string                 // Idioma escolhido ("" = padrão); mantido ao mudar de stage
+	CreatedAt    int64
+	UpdatedAt    int64
 }
 
 type IMessage struct {
@@ -43,6 +64,12 @@ type IMessage struct {
 	IsMedia    string
 	Expiration uint32
 	Quoted     *waE2E.ContextInfo
-	Reply      func(text string, opts ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
-	React      func(emoji string, opts ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	SelectedID string    // ID da opção escolhida em uma lista ou botão
+	Attachment *MediaRef // Mídia aceita pelo stage e guardada no media store
+	// Identificador que agrupa os logs do processamento desta mensagem
+	CorrelationID string
+	Log           *slog.Logger // Logger com correlation_id, sessão e remetente
+	Reply         func(text string, opts ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	ReplyMenu     func(stage *Stage, text string) (whatsmeow.SendResponse, error)
+	React         func(emoji string, opts ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
 }
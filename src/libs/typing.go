@@ -0,0 +1,103 @@
+package libs
+
+import (
+	"context"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Typing configura o indicador "digitando..." antes das respostas: o bot marca
+// a mensagem do membro como lida, mostra que está digitando por um tempo
+// proporcional ao tamanho da resposta e só então envia.
+type Typing struct {
+	Enabled bool
+	PerChar time.Duration // Tempo de digitação por caractere
+	Min     time.Duration
+	Max     time.Duration
+}
+
+// DefaultTyping usa a configuração do processo (TYPING_ENABLED,
+// TYPING_PER_CHAR, TYPING_MIN e TYPING_MAX). Stages podem sobrescrever com
+// Stage.Typing.
+func DefaultTyping(cfg *config.Config) *Typing {
+	typing := cfg.Typing
+	return &Typing{
+		Enabled: typing.Enabled,
+		PerChar: typing.PerChar,
+		Min:     typing.Min,
+		Max:     typing.Max,
+	}
+}
+
+// Configuração de digitação a usar no stage
+func (conn *IClient) stageTyping(stage *Stage) *Typing {
+	if stage != nil && stage.Typing != nil {
+		return stage.Typing
+	}
+	return DefaultTyping(conn.Config)
+}
+
+// Delay calcula quanto tempo "digitar" o texto, limitado por Min e Max
+func (t *Typing) Delay(text string) time.Duration {
+	if t == nil || !t.Enabled || text == "" {
+		return 0
+	}
+	delay := time.Duration(len([]rune(text))) * t.PerChar
+	if delay < t.Min {
+		delay = t.Min
+	}
+	if delay > t.Max {
+		delay = t.Max
+	}
+	return delay
+}
+
+// Tempo de digitação da mensagem conforme a configuração do IClient.
+// Apenas mensagens de texto e menus simulam digitação.
+func (conn *IClient) typingDelay(message *waE2E.Message) time.Duration {
+	if conn.Typing == nil {
+		return 0
+	}
+	if text := message.GetExtendedTextMessage().GetText(); text != "" {
+		return conn.Typing.Delay(text)
+	} else if text := message.GetConversation(); text != "" {
+		return conn.Typing.Delay(text)
+	} else if text := message.GetListMessage().GetDescription(); text != "" {
+		return conn.Typing.Delay(text)
+	} else if text := message.GetButtonsMessage().GetContentText(); text != "" {
+		return conn.Typing.Delay(text)
+	}
+	return 0
+}
+
+// Mostra "digitando..." na conversa pelo tempo informado
+func (conn *IClient) simulateTyping(ctx context.Context, to types.JID, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	if err := conn.Transport.SendChatPresence(to, types.ChatPresenceComposing, types.ChatPresenceMediaText); err != nil {
+		helpers.Logger("digitando").Warn("Erro ao enviar presença", "error", err)
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// Marca a mensagem do membro como lida antes de responder
+func (conn *IClient) MarkRead(m *IMessage) {
+	if conn.Typing == nil || !conn.Typing.Enabled || m.Info.ID == "" {
+		return
+	}
+	err := conn.Transport.MarkRead([]types.MessageID{m.Info.ID}, time.Now(), m.Info.Chat, m.Info.Sender)
+	if err != nil {
+		m.Log.Warn("Erro ao marcar mensagem como lida", "component", "digitando", "error", err)
+	}
+}
@@ -0,0 +1,171 @@
+package simulator
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"hisoka/src/libs"
+	"io"
+	"os"
+	"strings"
+)
+
+const replHelp = `Comandos:
+  /as <número>      Conversa como outro número
+  /name <nome>      Define o nome (push name) do usuário
+  /owner on|off     Liga/desliga o usuário como owner da sessão
+  /group <id>|off   Envia as mensagens no grupo informado ou na conversa privada
+  /stage            Mostra o stage atual do usuário
+  /reset            Volta o usuário ao stage raiz da sessão
+  /help             Mostra esta ajuda
+  /quit             Encerra o simulador
+Qualquer outro texto é enviado ao bot.`
+
+// Main executa o subcomando "simulate": uma conversa com o motor de stages
+// pelo terminal, sem parear um telefone
+func Main(args []string) int {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	phone := flags.String("phone", "", "número que conversa com o bot (padrão: o primeiro de ALLOWED_USERS)")
+	name := flags.String("name", "Simulador", "push name do usuário")
+	owner := flags.Bool("owner", false, "usuário é owner da sessão")
+	group := flags.String("group", "", "ID do grupo em que as mensagens são enviadas")
+	session := flags.String("session", "", "sessão simulada (padrão: a primeira configurada)")
+	dataDir := flags.String("data-dir", "", "diretório com o stages.db a usar (padrão: temporário)")
+	verbose := flags.Bool("verbose", false, "mostra os logs do motor de stages")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	sim, err := New(Options{SessionID: *session, DataDir: *dataDir, Verbose: *verbose})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ [SIMULATE] %s\n", err.Error())
+		return 1
+	}
+	defer sim.Close()
+
+	user := User{Phone: *phone, PushName: *name, Owner: *owner, Group: strings.TrimSuffix(*group, "@g.us")}
+	if user.Phone == "" {
+		user.Phone = defaultPhone(sim.Session)
+	}
+
+	fmt.Printf("🧪 Simulando a sessão '%s' (stage raiz '%s'), banco em %s\n", sim.Session.ID, sim.Session.RootStage, sim.DataDir())
+	fmt.Println("Digite /help para ver os comandos.")
+	Run(sim, user, os.Stdin, os.Stdout)
+	return 0
+}
+
+// Run lê as mensagens de in, uma por linha, e escreve as respostas do bot em out
+func Run(sim *Simulator, user User, in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "%s> ", prompt(user))
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			if !command(sim, &user, line, out) {
+				return
+			}
+			continue
+		}
+
+		turn, err := sim.Send(user, line)
+		if err != nil {
+			fmt.Fprintf(out, "❌ %s\n", err.Error())
+			continue
+		}
+		PrintTurn(out, turn)
+	}
+}
+
+// PrintTurn mostra as respostas e a mudança de stage de uma mensagem
+func PrintTurn(out io.Writer, turn *Turn) {
+	for _, reply := range turn.Replies {
+		text := strings.ReplaceAll(Describe(reply), "\n", "\n   ")
+		fmt.Fprintf(out, "🤖 %s\n", text)
+	}
+	if len(turn.Replies) == 0 {
+		fmt.Fprintln(out, "🤖 (sem resposta)")
+	}
+	if turn.StageBefore != turn.StageAfter {
+		fmt.Fprintf(out, "🔀 %s → %s\n", turn.StageBefore, turn.StageAfter)
+	}
+}
+
+// Executa um comando do simulador; false encerra
+func command(sim *Simulator, user *User, line string, out io.Writer) bool {
+	fields := strings.Fields(line)
+	arg := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+
+	switch fields[0] {
+	case "/quit", "/exit":
+		return false
+	case "/help":
+		fmt.Fprintln(out, replHelp)
+	case "/as":
+		if arg == "" {
+			fmt.Fprintln(out, "Uso: /as <número>")
+			break
+		}
+		user.Phone = strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, arg)
+	case "/name":
+		user.PushName = arg
+	case "/owner":
+		user.Owner = arg == "on" || arg == "true" || arg == "1"
+	case "/group":
+		if arg == "off" {
+			arg = ""
+		}
+		user.Group = strings.TrimSuffix(arg, "@g.us")
+	case "/stage":
+		stage, err := sim.Stage(user.Phone)
+		if err != nil {
+			fmt.Fprintf(out, "❌ %s\n", err.Error())
+			break
+		}
+		fmt.Fprintf(out, "📍 %s\n", stage)
+	case "/reset":
+		if err := sim.Reset(user.Phone); err != nil {
+			fmt.Fprintf(out, "❌ %s\n", err.Error())
+			break
+		}
+		fmt.Fprintf(out, "📍 %s\n", sim.Session.RootStage)
+	default:
+		fmt.Fprintf(out, "Comando desconhecido: %s (digite /help)\n", fields[0])
+	}
+	return true
+}
+
+// Número usado quando nenhum é informado: o primeiro atendido pela sessão
+func defaultPhone(session *libs.Session) string {
+	if len(session.AllowedUsers) > 0 {
+		return session.AllowedUsers[0]
+	}
+	return "5511999990000"
+}
+
+// Prompt com o número e os modos ativos
+func prompt(user User) string {
+	var tags []string
+	if user.Owner {
+		tags = append(tags, "owner")
+	}
+	if user.Group != "" {
+		tags = append(tags, "grupo "+user.Group)
+	}
+	if len(tags) == 0 {
+		return user.Phone
+	}
+	return user.Phone + " (" + strings.Join(tags, ", ") + ")"
+}
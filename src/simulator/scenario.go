@@ -0,0 +1,402 @@
+package simulator
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Data fixa das mensagens dos cenários, para que protocolos não mudem a cada dia
+var scenarioClock = time.Date(2024, time.January, 2, 9, 0, 0, 0, time.Local)
+
+// Trechos que variam entre execuções e são trocados antes de comparar com o
+// arquivo golden (além dos "mask" do cenário)
+var defaultMasks = []string{
+	`\d{2}/\d{2}/\d{4} \d{2}:\d{2}`, // Data atual dos templates
+}
+
+// Scenario é uma conversa roteirizada: as mensagens enviadas ao bot e o que se
+// espera de cada resposta
+type Scenario struct {
+	Name    string            `yaml:"name"`
+	Session string            `yaml:"session"`
+	Env     map[string]string `yaml:"env"`
+	User    ScenarioUser      `yaml:"user"`
+	Mask    []string          `yaml:"mask"`
+	Steps   []Step            `yaml:"steps"`
+
+	Path string `yaml:"-"`
+}
+
+// Usuário que conversa com o bot no cenário
+type ScenarioUser struct {
+	Phone string `yaml:"phone"`
+	Name  string `yaml:"name"`
+	Owner bool   `yaml:"owner"`
+	Group string `yaml:"group"`
+}
+
+// Step é uma mensagem do usuário e as expectativas sobre a resposta
+type Step struct {
+	Send   string `yaml:"send"`
+	Expect Expect `yaml:"expect"`
+}
+
+// Expect descreve a resposta esperada. Campos vazios não são verificados.
+type Expect struct {
+	Stage       string     `yaml:"stage"`
+	Contains    StringList `yaml:"contains"`
+	NotContains StringList `yaml:"not_contains"`
+	Replies     *int       `yaml:"replies"`
+}
+
+// StringList aceita tanto um texto quanto uma lista de textos no YAML
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = StringList{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Result é o resultado da execução de um cenário
+type Result struct {
+	Scenario   *Scenario
+	Failures   []string
+	Transcript string
+	GoldenDiff string // Diferenças em relação ao arquivo golden ("" se iguais)
+	Updated    bool   // O arquivo golden foi regravado
+}
+
+// Passed informa se o cenário passou em todas as verificações
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0 && r.GoldenDiff == ""
+}
+
+// Arquivo golden do cenário: a transcrição esperada, ao lado do YAML
+func (sc *Scenario) GoldenPath() string {
+	return strings.TrimSuffix(sc.Path, filepath.Ext(sc.Path)) + ".golden"
+}
+
+// LoadScenarios lê os cenários dos arquivos informados; diretórios são
+// percorridos em busca de arquivos .yaml/.yml
+func LoadScenarios(paths []string) ([]*Scenario, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(file); !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+
+	var scenarios []*Scenario
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		// Campos desconhecidos são erro: um "expect" mal indentado não pode
+		// virar um cenário que sempre passa
+		var scenario Scenario
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&scenario); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(scenario.Steps) == 0 {
+			return nil, fmt.Errorf("%s: cenário sem steps", file)
+		}
+		if scenario.Name == "" {
+			scenario.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		scenario.Path = file
+		scenarios = append(scenarios, &scenario)
+	}
+	return scenarios, nil
+}
+
+// RunScenario executa o cenário em um banco temporário, verifica as
+// expectativas de cada step e compara a transcrição com o arquivo golden
+// (ou o regrava, com update)
+func RunScenario(sc *Scenario, update bool) (*Result, error) {
+	masks, err := compileMasks(sc.Mask)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", sc.Path, err)
+	}
+
+	restore := setEnv(sc.Env)
+	defer restore()
+
+	sim, err := New(Options{SessionID: sc.Session})
+	if err != nil {
+		return nil, err
+	}
+	defer sim.Close()
+	sim.Clock = func() time.Time { return scenarioClock }
+
+	user := User{Phone: sc.User.Phone, PushName: sc.User.Name, Owner: sc.User.Owner, Group: strings.TrimSuffix(sc.User.Group, "@g.us")}
+	if user.Phone == "" {
+		user.Phone = defaultPhone(sim.Session)
+	}
+	if user.PushName == "" {
+		user.PushName = "Cenário"
+	}
+
+	result := &Result{Scenario: sc}
+	var transcript bytes.Buffer
+	for i, step := range sc.Steps {
+		turn, err := sim.Send(user, step.Send)
+		if err != nil {
+			return nil, fmt.Errorf("%s: step %d: %w", sc.Path, i+1, err)
+		}
+		fmt.Fprintf(&transcript, "> %s\n", step.Send)
+		PrintTurn(&transcript, turn)
+		for _, failure := range checkStep(step.Expect, turn) {
+			result.Failures = append(result.Failures, fmt.Sprintf("step %d (%q): %s", i+1, step.Send, failure))
+		}
+	}
+	result.Transcript = applyMasks(transcript.String(), masks)
+
+	golden := sc.GoldenPath()
+	if update {
+		if err := os.WriteFile(golden, []byte(result.Transcript), 0644); err != nil {
+			return nil, err
+		}
+		result.Updated = true
+		return result, nil
+	}
+	expected, err := os.ReadFile(golden)
+	if os.IsNotExist(err) {
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if string(expected) != result.Transcript {
+		result.GoldenDiff = lineDiff(string(expected), result.Transcript)
+	}
+	return result, nil
+}
+
+// Verifica as expectativas de um step
+func checkStep(expect Expect, turn *Turn) []string {
+	var failures []string
+	var texts []string
+	for _, reply := range turn.Replies {
+		texts = append(texts, Describe(reply))
+	}
+	all := strings.Join(texts, "\n")
+
+	if expect.Stage != "" && turn.StageAfter != expect.Stage {
+		failures = append(failures, fmt.Sprintf("stage esperado '%s', obtido '%s'", expect.Stage, turn.StageAfter))
+	}
+	if expect.Replies != nil && len(turn.Replies) != *expect.Replies {
+		failures = append(failures, fmt.Sprintf("%d respostas esperadas, obtidas %d", *expect.Replies, len(turn.Replies)))
+	}
+	for _, text := range expect.Contains {
+		if !strings.Contains(all, text) {
+			failures = append(failures, fmt.Sprintf("resposta sem %q:\n%s", text, indent(all)))
+		}
+	}
+	for _, text := range expect.NotContains {
+		if strings.Contains(all, text) {
+			failures = append(failures, fmt.Sprintf("resposta não deveria conter %q", text))
+		}
+	}
+	return failures
+}
+
+// Aplica as variáveis de ambiente do cenário e devolve a função que restaura
+// os valores anteriores
+func setEnv(env map[string]string) func() {
+	previous := make(map[string]*string)
+	for key, value := range env {
+		if old, ok := os.LookupEnv(key); ok {
+			previous[key] = &old
+		} else {
+			previous[key] = nil
+		}
+		os.Setenv(key, value)
+	}
+	return func() {
+		for key, old := range previous {
+			if old == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *old)
+			}
+		}
+	}
+}
+
+func compileMasks(extra []string) ([]*regexp.Regexp, error) {
+	var masks []*regexp.Regexp
+	for _, pattern := range append(append([]string{}, defaultMasks...), extra...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("mask inválida %q: %w", pattern, err)
+		}
+		masks = append(masks, re)
+	}
+	return masks, nil
+}
+
+func applyMasks(text string, masks []*regexp.Regexp) string {
+	for _, re := range masks {
+		text = re.ReplaceAllString(text, "<…>")
+	}
+	return text
+}
+
+// Diferença linha a linha entre o esperado (-) e o obtido (+), com duas
+// linhas de contexto em volta de cada trecho alterado
+func lineDiff(expected, actual string) string {
+	a := strings.Split(expected, "\n")
+	b := strings.Split(actual, "\n")
+
+	// Maior subsequência comum
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j]})
+			j++
+		}
+	}
+
+	const context = 2
+	var out strings.Builder
+	last := -1
+	for k := range lines {
+		near := false
+		for d := max(0, k-context); d <= min(len(lines)-1, k+context); d++ {
+			if lines[d].op != ' ' {
+				near = true
+				break
+			}
+		}
+		if !near {
+			continue
+		}
+		if last >= 0 && k > last+1 {
+			out.WriteString("  ...\n")
+		}
+		fmt.Fprintf(&out, "%c %s\n", lines[k].op, lines[k].text)
+		last = k
+	}
+	return out.String()
+}
+
+func indent(text string) string {
+	return "    " + strings.ReplaceAll(text, "\n", "\n    ")
+}
+
+// ScenariosMain executa o subcomando "scenarios": roda os cenários dos
+// arquivos/diretórios informados (padrão: scenarios/) e sai com 1 se algum
+// falhar. Com -update, regrava os arquivos golden.
+func ScenariosMain(args []string) int {
+	flags := flag.NewFlagSet("scenarios", flag.ContinueOnError)
+	update := flags.Bool("update", false, "regrava os arquivos .golden com as respostas atuais")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"scenarios"}
+	}
+
+	scenarios, err := LoadScenarios(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ [SCENARIOS] %s\n", err.Error())
+		return 2
+	}
+
+	failed := 0
+	for _, scenario := range scenarios {
+		result, err := RunScenario(scenario, *update)
+		if err != nil {
+			fmt.Printf("❌ %s: %s\n", scenario.Name, err.Error())
+			failed++
+			continue
+		}
+		switch {
+		case !result.Passed():
+			failed++
+			fmt.Printf("❌ %s (%s)\n", scenario.Name, scenario.Path)
+			for _, failure := range result.Failures {
+				fmt.Printf("   %s\n", strings.ReplaceAll(failure, "\n", "\n   "))
+			}
+			if result.GoldenDiff != "" {
+				fmt.Printf("   Transcrição diferente de %s (-esperado +obtido):\n%s", scenario.GoldenPath(), indent(result.GoldenDiff))
+				fmt.Println()
+			}
+		case result.Updated:
+			fmt.Printf("📝 %s (%s atualizado)\n", scenario.Name, scenario.GoldenPath())
+		default:
+			fmt.Printf("✅ %s\n", scenario.Name)
+		}
+	}
+
+	fmt.Printf("\n%d cenário(s), %d falha(s)\n", len(scenarios), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package simulator
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regrava os arquivos .golden com as respostas atuais")
+
+// Os cenários usam caminhos relativos à raiz do repositório (ex:
+// CREDIT_LINES_FILE), como em "go run . scenarios"
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// Executa scenarios/*.yaml e compara com os arquivos .golden. Para aceitar
+// mudanças intencionais: go test ./src/simulator -run TestScenarios -update
+func TestScenarios(t *testing.T) {
+	scenarios, err := LoadScenarios([]string{"scenarios"})
+	if err != nil {
+		t.Fatalf("LoadScenarios: %v", err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatal("nenhum cenário em scenarios/")
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.Name, func(t *testing.T) {
+			if !*update {
+				if _, err := os.Stat(scenario.GoldenPath()); err != nil {
+					t.Fatalf("%s sem arquivo golden (gere com -update): %v", scenario.Path, err)
+				}
+			}
+
+			result, err := RunScenario(scenario, *update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, failure := range result.Failures {
+				t.Error(failure)
+			}
+			if result.GoldenDiff != "" {
+				t.Errorf("transcrição diferente de %s (-esperado +obtido):\n%s", scenario.GoldenPath(), result.GoldenDiff)
+			}
+			if result.Updated {
+				t.Logf("%s atualizado", scenario.GoldenPath())
+			}
+		})
+	}
+}
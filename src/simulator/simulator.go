@@ -0,0 +1,268 @@
+package simulator
+
+import (
+	"fmt"
+	"hisoka/src/config"
+	"hisoka/src/helpers"
+	"hisoka/src/libs"
+	"os"
+	"strings"
+	"time"
+
+	_ "hisoka/src/stages"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Options configura o simulador
+type Options struct {
+	SessionID string // Sessão simulada ("" = a primeira sessão configurada)
+	DataDir   string // Diretório do stages.db ("" = diretório temporário, apagado no Close)
+	Verbose   bool   // Mostra os logs do motor de stages
+}
+
+// User é quem conversa com o bot no simulador
+type User struct {
+	Phone    string
+	PushName string
+	Owner    bool
+	Group    string // ID do grupo ("" = conversa privada)
+}
+
+// Turn é o resultado de uma mensagem enviada ao bot
+type Turn struct {
+	User        User
+	Text        string
+	StageBefore string
+	StageAfter  string
+	Handled     bool
+	Replies     []libs.SentMessage
+}
+
+// Simulator executa o motor de stages sobre um FakeTransport, sem WhatsApp
+type Simulator struct {
+	Conn    *libs.IClient
+	Fake    *libs.FakeTransport
+	Session *libs.Session
+	Verbose bool
+
+	// Relógio das mensagens simuladas (data do protocolo); time.Now se nil
+	Clock func() time.Time
+
+	dataDir string
+	temp    bool
+	seq     int
+}
+
+// New inicializa stages, banco e templates para a simulação
+func New(opts Options) (*Simulator, error) {
+	dataDir, temp := opts.DataDir, false
+	if dataDir == "" {
+		dir, err := os.MkdirTemp("", "simulate-")
+		if err != nil {
+			return nil, err
+		}
+		dataDir, temp = dir, true
+	}
+	sim := &Simulator{Verbose: opts.Verbose, dataDir: dataDir, temp: temp}
+
+	// Relê a configuração para aplicar as variáveis de ambiente do cenário
+	cfg, err := config.Load()
+	if err != nil {
+		sim.Close()
+		return nil, err
+	}
+	cfg.DataDir = dataDir
+	// O estado simulado fica no stages.db de dataDir, nunca no banco de
+	// produção de STATE_DATABASE_URL
+	if cfg.StateStore == "postgres" {
+		cfg.StateStore = "sqlite"
+		cfg.StateDatabaseURL = ""
+	}
+	// Sem atraso de digitação: as respostas aparecem na hora
+	cfg.Typing.Enabled = false
+
+	err = sim.quiet(func() error {
+		if _, err := libs.LoadSessions(cfg); err != nil {
+			return err
+		}
+		if err := libs.InitStages(cfg); err != nil {
+			return err
+		}
+		if err := libs.LoadTemplates(cfg); err != nil {
+			return err
+		}
+		return libs.ValidateTemplates()
+	})
+	if err != nil {
+		sim.Close()
+		return nil, err
+	}
+
+	session := libs.DefaultSession()
+	if opts.SessionID != "" {
+		session = libs.GetSession(opts.SessionID)
+		if session == nil {
+			sim.Close()
+			return nil, fmt.Errorf("sessão '%s' não configurada", opts.SessionID)
+		}
+	}
+	sim.Session = session
+	sim.Conn, sim.Fake = libs.NewFakeClient(session)
+	return sim, nil
+}
+
+// Diretório do stages.db usado pela simulação
+func (s *Simulator) DataDir() string {
+	return s.dataDir
+}
+
+// Send entrega o texto ao bot como se tivesse sido enviado pelo usuário e
+// devolve as respostas e a mudança de stage
+func (s *Simulator) Send(user User, text string) (*Turn, error) {
+	return s.SendMessage(user, text, nil)
+}
+
+// SendMessage entrega uma mensagem qualquer (ex: resposta de lista ou mídia)
+func (s *Simulator) SendMessage(user User, text string, message *waE2E.Message) (*Turn, error) {
+	s.setOwner(user.Phone, user.Owner)
+
+	before, err := libs.GetUserStage(s.Session.ID, user.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	s.seq++
+	now := time.Now()
+	if s.Clock != nil {
+		now = s.Clock()
+	}
+	params := libs.MessageParams{
+		ID:        types.MessageID(fmt.Sprintf("SIM%09d", s.seq)),
+		Timestamp: now,
+		Sender:    types.NewJID(user.Phone, types.DefaultUserServer),
+		PushName:  user.PushName,
+		Text:      text,
+		Message:   message,
+	}
+	if user.Group != "" {
+		params.Chat = types.NewJID(user.Group, types.GroupServer)
+	}
+	m := libs.NewMessage(s.Conn, params)
+
+	s.Fake.Reset()
+	turn := &Turn{User: user, Text: text, StageBefore: before.CurrentStage}
+	s.quiet(func() error {
+		turn.Handled = libs.ProcessStageMessage(s.Conn, m)
+		return nil
+	})
+	turn.Replies = s.Fake.Messages()
+
+	after, err := libs.GetUserStage(s.Session.ID, user.Phone)
+	if err != nil {
+		return nil, err
+	}
+	turn.StageAfter = after.CurrentStage
+	return turn, nil
+}
+
+// Stage atual do usuário
+func (s *Simulator) Stage(phone string) (string, error) {
+	userStage, err := libs.GetUserStage(s.Session.ID, phone)
+	if err != nil {
+		return "", err
+	}
+	return userStage.CurrentStage, nil
+}
+
+// Reset volta o usuário ao stage raiz da sessão, descartando os dados do stage
+func (s *Simulator) Reset(phone string) error {
+	userStage, err := libs.GetUserStage(s.Session.ID, phone)
+	if err != nil {
+		return err
+	}
+	userStage.CurrentStage = s.Session.RootStage
+	userStage.Data = make(map[string]interface{})
+	return libs.SaveUserStage(userStage)
+}
+
+// Close fecha o banco e apaga o diretório temporário
+func (s *Simulator) Close() error {
+	err := libs.CloseStagesDB()
+	if s.temp {
+		os.RemoveAll(s.dataDir)
+	}
+	return err
+}
+
+// O owner do simulador é definido pelo usuário da mensagem, não pelo OWNER
+func (s *Simulator) setOwner(phone string, owner bool) {
+	if s.Session == nil || s.Session.IsOwner(phone) == owner {
+		return
+	}
+	if owner {
+		s.Session.Owners = append(s.Session.Owners, phone)
+		return
+	}
+	var owners []string
+	for _, current := range s.Session.Owners {
+		if current != phone {
+			owners = append(owners, current)
+		}
+	}
+	s.Session.Owners = owners
+}
+
+// Executa fn descartando os logs do motor, exceto
+// no modo verbose
+func (s *Simulator) quiet(fn func() error) error {
+	if s.Verbose {
+		return fn()
+	}
+	return helpers.WithoutLogs(fn)
+}
+
+// Describe descreve a mensagem enviada pelo bot em texto, incluindo as opções
+// de listas e botões e o tipo das mídias
+func Describe(sent libs.SentMessage) string {
+	msg := sent.Message
+	var out strings.Builder
+	switch {
+	case msg.GetListMessage() != nil:
+		list := msg.GetListMessage()
+		if list.GetTitle() != "" {
+			fmt.Fprintf(&out, "*%s*\n", list.GetTitle())
+		}
+		out.WriteString(list.GetDescription())
+		for _, section := range list.GetSections() {
+			fmt.Fprintf(&out, "\n[%s]", section.GetTitle())
+			for _, row := range section.GetRows() {
+				fmt.Fprintf(&out, "\n  (%s) %s", row.GetRowID(), row.GetTitle())
+				if row.GetDescription() != "" {
+					fmt.Fprintf(&out, " - %s", row.GetDescription())
+				}
+			}
+		}
+	case msg.GetButtonsMessage() != nil:
+		buttons := msg.GetButtonsMessage()
+		out.WriteString(buttons.GetContentText())
+		for _, button := range buttons.GetButtons() {
+			fmt.Fprintf(&out, "\n  [%s] %s", button.GetButtonID(), button.GetButtonText().GetDisplayText())
+		}
+	case msg.GetImageMessage() != nil:
+		fmt.Fprintf(&out, "[imagem %s] %s", msg.GetImageMessage().GetMimetype(), msg.GetImageMessage().GetCaption())
+	case msg.GetVideoMessage() != nil:
+		fmt.Fprintf(&out, "[vídeo %s] %s", msg.GetVideoMessage().GetMimetype(), msg.GetVideoMessage().GetCaption())
+	case msg.GetDocumentMessage() != nil:
+		document := msg.GetDocumentMessage()
+		fmt.Fprintf(&out, "[documento %s, %d bytes] %s", document.GetFileName(), document.GetFileLength(), document.GetCaption())
+	case msg.GetStickerMessage() != nil:
+		out.WriteString("[figurinha]")
+	case msg.GetReactionMessage() != nil:
+		fmt.Fprintf(&out, "[reação %s]", msg.GetReactionMessage().GetText())
+	default:
+		out.WriteString(sent.Text())
+	}
+	return strings.TrimSpace(out.String())
+}
@@ -1,8 +1,6 @@
 package stages
 
 // Este arquivo importa todos os packages de stages para garantir
-// que suas funções init() sejam executadas
-
-import (
-	_ "hisoka/src/stages/basic"
-)
+// que suas funções init() sejam executadas. Os stages principais (default,
+// adesao, aplicativo, informe...) são registrados em libs (registerBasicStages);
+// pacotes novos entram aqui, ex: _ "hisoka/src/stages/meustage"